@@ -5,17 +5,42 @@
 package gqueue
 
 import (
+	"errors"
 	"runtime"
 	"sync"
 )
 
+var (
+	// ErrQueueFull 任务数超过了New指定的任务总数
+	ErrQueueFull = errors.New("task queue is full")
+
+	// ErrQueueClosed 任务队列已经关闭
+	ErrQueueClosed = errors.New("task queue is closed")
+)
+
 type Queue struct {
-	gNum             int                     // 并发执行任务所需要的goroutine个数
-	taskTotal        int                     // 执行任务的总数
-	tasks            chan func() interface{} // 任务放置在缓冲通道中
-	taskCallback     func(res interface{})   // 每个任务执行后的回调函数
-	finishedCallback func()                  // 所有任务执行完毕后的回调
-	wg               sync.WaitGroup          // 保证goroutine同步执行的信号计数器
+	gNum             int                   // 并发执行任务所需要的goroutine个数
+	taskTotal        int                   // 执行任务的总数
+	tasks            chan *job             // 任务放置在缓冲通道中
+	taskCallback     func(res interface{}) // 每个任务执行后的回调函数
+	resultCallback   func(res Result)      // 每个任务执行后带有任务id的回调函数
+	finishedCallback func()                // 所有任务执行完毕后的回调
+	wg               sync.WaitGroup        // 保证goroutine同步执行的信号计数器
+	stream           bool                  // 是否为不限制任务总数的流式队列
+	life             sync.Mutex            // 保证流式队列的Start串行执行
+	mu               sync.RWMutex          // 保护tasks,closed,closing,drained,running,done
+	closed           bool                  // 流式队列是否已经关闭
+	closing          chan struct{}         // 流式队列关闭时关闭，通知阻塞的Add返回
+	drained          chan struct{}         // tasks通道关闭后关闭
+	running          bool                  // 流式队列是否正在执行
+	done             chan struct{}         // 流式队列所有任务执行完毕的信号
+	sending          sync.WaitGroup        // 正在发送到tasks中的任务个数
+	resMu            sync.Mutex            // 保护seq,results,errs,firstErr
+	seq              int                   // 最后一个添加的任务id
+	keepResults      bool                  // 是否保存每个任务的执行结果
+	results          map[int]Result        // 每个任务的执行结果
+	errs             map[int]error         // 执行失败的任务id对应的错误
+	firstErr         error                 // 第一个执行失败的任务的错误
 }
 
 // New 创建一个任务队列实例
@@ -28,15 +53,51 @@ func New(number, total int) *Queue {
 		number = total
 	}
 
-	return &Queue{
-		gNum:      number,
-		taskTotal: total,
-		tasks:     make(chan func() interface{}, total), // 缓冲通道个数是total,类型是func() interface{}
+	q := &Queue{
+		gNum:        number,
+		taskTotal:   total,
+		tasks:       make(chan *job, total), // 缓冲通道个数是total
+		keepResults: true,
 	}
+
+	q.reset()
+	return q
 }
 
-// Start 开始执行任务
-func (q *Queue) Start() {
+// NewStream 创建一个不限制任务总数的流式任务队列
+// number为执行任务的goroutine个数，size为任务缓冲通道的大小，缓冲通道满了之后Add会阻塞
+// 流式队列的Start不会阻塞，可以不断的Add任务，Close之后等待所有任务执行完毕
+// Close之后可以再次调用Start复用该队列
+func NewStream(number, size int) *Queue {
+	if number < 1 {
+		number = 1
+	}
+
+	if size < 0 {
+		size = 0
+	}
+
+	q := &Queue{
+		gNum:    number,
+		tasks:   make(chan *job, size),
+		stream:  true,
+		closing: make(chan struct{}),
+		drained: make(chan struct{}),
+	}
+
+	q.reset()
+	return q
+}
+
+// Start 开始执行任务，返回第一个执行失败的任务的错误
+// New创建的队列会阻塞直到所有任务执行完毕，NewStream创建的队列启动goroutine后立即返回nil
+// 流式队列的错误通过Close返回
+func (q *Queue) Start() error {
+	if q.stream {
+		q.startStream()
+		return nil
+	}
+
 	defer close(q.tasks) // 任务执行完毕后,关闭通道
 
 	// 设置计数信号个数
@@ -55,31 +116,169 @@ func (q *Queue) Start() {
 	if q.finishedCallback != nil {
 		q.finishedCallback()
 	}
+
+	return q.Err()
 }
 
 // work 执行任务
 func (q *Queue) work() {
 	for {
 		// 不断取出任务,直到chan关闭
-		task, ok := <-q.tasks
+		j, ok := <-q.tasks
 		if !ok {
 			break
 		}
 
-		res := task()
-		// 完成一个task立即回调
-		if q.taskCallback != nil {
-			q.taskCallback(res)
+		q.exec(j)
+		q.wg.Done()
+	}
+}
+
+// startStream 启动流式队列的goroutine，已经在执行的话直接返回
+func (q *Queue) startStream() {
+	q.life.Lock()
+	defer q.life.Unlock()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running {
+		return
+	}
+
+	// 重新打开已经关闭的队列，保留没有执行的任务
+	if q.closed {
+		// 等待Close关闭tasks通道
+		drained := q.drained
+		q.mu.Unlock()
+		<-drained
+		q.mu.Lock()
+
+		tasks := make(chan *job, cap(q.tasks))
+		for j := range q.tasks {
+			tasks <- j
 		}
 
-		q.wg.Done()
+		q.tasks = tasks
+		q.closed = false
+		q.closing = make(chan struct{})
+		q.drained = make(chan struct{})
+		q.reset()
+	}
+
+	q.running = true
+	q.done = make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(q.gNum)
+	for i := 0; i < q.gNum; i++ {
+		go func(tasks <-chan *job) {
+			defer wg.Done()
+
+			for j := range tasks {
+				q.exec(j)
+			}
+		}(q.tasks)
 	}
+
+	go func(done chan struct{}) {
+		wg.Wait()
+
+		// 当所有的任务执行完毕后回调
+		if q.finishedCallback != nil {
+			q.finishedCallback()
+		}
+
+		q.mu.Lock()
+		q.running = false
+		q.mu.Unlock()
+
+		close(done)
+	}(q.done)
+}
+
+// Close 关闭流式队列，不再接收新的任务，等待已经添加的任务执行完毕
+// 阻塞在Add中的任务不会再被添加，Add返回ErrQueueClosed
+// 还没有Start时，Close直接返回，已经添加的任务在下一次Start时执行
+// 返回第一个执行失败的任务的错误，对于New创建的队列，Close不做任何操作
+func (q *Queue) Close() error {
+	if !q.stream {
+		return nil
+	}
+
+	q.mu.Lock()
+	closed := q.closed
+	tasks, drained := q.tasks, q.drained
+	if !closed {
+		q.closed = true
+		close(q.closing)
+	}
+	q.mu.Unlock()
+
+	if !closed {
+		// 等待正在发送的Add返回之后再关闭通道
+		q.sending.Wait()
+		close(tasks)
+		close(drained)
+	}
+
+	q.mu.RLock()
+	running, done := q.running, q.done
+	q.mu.RUnlock()
+
+	if running {
+		<-done
+	}
+
+	return q.Err()
 }
 
 // Add 添加任务
-func (q *Queue) Add(task func() interface{}) {
-	if len(q.tasks) <= q.taskTotal-1 { // 防止缓冲通道个数超出边界个数total
-		q.tasks <- task
+// New创建的队列任务数超过total时返回ErrQueueFull
+// NewStream创建的队列缓冲通道满了之后阻塞，队列关闭后返回ErrQueueClosed
+func (q *Queue) Add(task func() interface{}) error {
+	_, err := q.Submit(func() (interface{}, error) {
+		return task(), nil
+	})
+
+	return err
+}
+
+// Submit 添加一个有错误返回的任务，返回任务id，任务id按照添加的顺序从1开始递增
+// 任务的执行结果可以通过Results按照添加的顺序获取，或者通过SetResultCallback获取
+func (q *Queue) Submit(task func() (interface{}, error)) (int, error) {
+	if !q.stream {
+		q.resMu.Lock()
+		defer q.resMu.Unlock()
+
+		if q.seq >= q.taskTotal { // 防止缓冲通道个数超出边界个数total
+			return 0, ErrQueueFull
+		}
+
+		q.seq++
+		q.tasks <- &job{id: q.seq, fn: task}
+		return q.seq, nil
+	}
+
+	q.mu.RLock()
+	if q.closed {
+		q.mu.RUnlock()
+		return 0, ErrQueueClosed
+	}
+
+	// 记录正在发送的任务，保证Close不会在发送过程中关闭通道
+	q.sending.Add(1)
+	defer q.sending.Done()
+
+	tasks, closing := q.tasks, q.closing
+	q.mu.RUnlock()
+
+	id := q.nextID()
+	select {
+	case tasks <- &job{id: id, fn: task}:
+		return id, nil
+	case <-closing:
+		return 0, ErrQueueClosed
 	}
 }
 
@@ -1,8 +1,14 @@
 package gqueue
 
 import (
+	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/daheige/thinkgo/gtask"
 )
 
 func TestQue(t *testing.T) {
@@ -39,6 +45,206 @@ func task(i int) func() interface{} {
 	}
 }
 
+// TestStream test streaming queue
+func TestStream(t *testing.T) {
+	var count, finished int32
+	q := NewStream(4, 2)
+	q.SetTaskCallback(func(res interface{}) {
+		atomic.AddInt32(&count, 1)
+	})
+	q.SetFinishedCallback(func() {
+		atomic.AddInt32(&finished, 1)
+	})
+
+	for round := 1; round <= 2; round++ {
+		q.Start()
+
+		var wg sync.WaitGroup
+		for p := 0; p < 4; p++ {
+			wg.Add(1)
+			go func(p int) {
+				defer wg.Done()
+
+				for i := 0; i < 50; i++ {
+					if err := q.Add(task(p*100 + i)); err != nil {
+						t.Errorf("add task error: %v", err)
+					}
+				}
+			}(p)
+		}
+
+		wg.Wait()
+		q.Close()
+		if n := atomic.LoadInt32(&count); n != int32(round*200) {
+			t.Fatalf("round %d exec tasks: %d", round, n)
+		}
+
+		if n := atomic.LoadInt32(&finished); n != int32(round) {
+			t.Fatalf("round %d finished callback: %d", round, n)
+		}
+
+		if err := q.Add(task(0)); err != ErrQueueClosed {
+			t.Fatalf("add after close error: %v", err)
+		}
+	}
+
+	// 超过任务总数的任务返回ErrQueueFull
+	fixed := New(1, 1)
+	if err := fixed.Add(task(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fixed.Add(task(2)); err != ErrQueueFull {
+		t.Fatalf("add error: %v", err)
+	}
+}
+
+// TestStreamClose test Close before Start and Close with a blocked producer
+func TestStreamClose(t *testing.T) {
+	var count int32
+	q := NewStream(1, 1)
+	q.SetTaskCallback(func(res interface{}) {
+		atomic.AddInt32(&count, 1)
+	})
+
+	// 还没有Start时，缓冲通道满了之后阻塞的Add在Close后返回
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			errs <- q.Add(task(i))
+		}(i)
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("add error: %v", err)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- q.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("close error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close before start should not block")
+	}
+
+	if err := <-errs; err != ErrQueueClosed {
+		t.Fatalf("blocked add error: %v", err)
+	}
+
+	// 再次Start时执行已经添加的任务
+	q.Start()
+	q.Close()
+	if n := atomic.LoadInt32(&count); n != 1 {
+		t.Fatalf("exec tasks: %d", n)
+	}
+
+	// 正在执行时，阻塞的生产者在Close后返回
+	release := make(chan struct{})
+	s := NewStream(1, 0)
+	s.Start()
+	s.Add(func() interface{} {
+		<-release
+		return nil
+	})
+
+	added := make(chan error, 1)
+	go func() {
+		added <- s.Add(task(1))
+	}()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	if err := <-added; err != nil && err != ErrQueueClosed {
+		t.Fatalf("blocked add error: %v", err)
+	}
+}
+
+// TestResults test ordered results and error propagation
+func TestResults(t *testing.T) {
+	errOdd := errors.New("odd number")
+	q := New(4, 10)
+	for i := 0; i < 10; i++ {
+		i := i
+		id, err := q.Submit(func() (interface{}, error) {
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			if i == 7 {
+				panic("task 7 panic")
+			}
+
+			if i%2 == 1 {
+				return nil, errOdd
+			}
+
+			return i * i, nil
+		})
+		if err != nil || id != i+1 {
+			t.Fatalf("submit id: %d error: %v", id, err)
+		}
+	}
+
+	if err := q.Start(); err == nil {
+		t.Fatal("start should return the first error")
+	}
+
+	results := q.Results()
+	if len(results) != 10 {
+		t.Fatalf("results: %v", results)
+	}
+
+	for i, res := range results {
+		if res.ID != i+1 {
+			t.Fatalf("result order: %v", results)
+		}
+
+		if i%2 == 0 && res.Value != i*i {
+			t.Fatalf("result %d: %+v", i, res)
+		}
+	}
+
+	var pe *gtask.PanicError
+	if errs := q.Errors(); len(errs) != 5 || !errors.As(errs[8], &pe) || errs[2] != errOdd {
+		t.Fatalf("errors: %v", errs)
+	}
+
+	// 流式队列通过Close返回错误
+	s := NewStream(2, 0)
+	ids := make(chan int, 3)
+	s.SetResultCallback(func(res Result) {
+		if res.Err != nil {
+			ids <- res.ID
+		}
+	})
+
+	s.Start()
+	s.Submit(func() (interface{}, error) { return 1, nil })
+	s.Submit(func() (interface{}, error) { return nil, errOdd })
+	if err := s.Close(); err != errOdd {
+		t.Fatalf("close error: %v", err)
+	}
+
+	if id := <-ids; id != 2 {
+		t.Fatalf("error task id: %d", id)
+	}
+
+	// 不保存执行结果时只记录第一个错误
+	if errs := s.Errors(); len(errs) != 0 {
+		t.Fatalf("stream errors: %v", errs)
+	}
+}
+
 /**
  * $ go test -v -test.run TestQue
  * 2018/10/28 15:06:00 all task has finished
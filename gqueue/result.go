@@ -0,0 +1,139 @@
+package gqueue
+
+import (
+	"sort"
+
+	"github.com/daheige/thinkgo/grecover"
+	"github.com/daheige/thinkgo/gtask"
+)
+
+// job 带有任务id的任务
+type job struct {
+	id int
+	fn func() (interface{}, error)
+}
+
+// Result 每个任务的执行结果
+type Result struct {
+	ID    int         // 任务id，按照添加的顺序从1开始递增
+	Value interface{} // 任务的返回值
+	Err   error       // 任务执行的错误，发生panic时为*gtask.PanicError
+}
+
+// SetResultCallback 设置单个任务执行后的回调函数，按照任务完成的顺序回调
+// 可以通过Result.ID对应到Submit返回的任务id
+func (q *Queue) SetResultCallback(callback func(res Result)) {
+	q.resultCallback = callback
+}
+
+// SetKeepResults 设置是否保存每个任务的执行结果和错误，用于Results和Errors获取
+// New创建的队列默认保存，NewStream创建的队列默认不保存，避免长时间运行占用过多的内存
+func (q *Queue) SetKeepResults(keep bool) {
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	q.keepResults = keep
+}
+
+// Results 按照任务添加的顺序获取已经执行完毕的任务结果
+// 流式队列重新Start之后会清空上一次的执行结果
+func (q *Queue) Results() []Result {
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	results := make([]Result, 0, len(q.results))
+	for _, res := range q.results {
+		results = append(results, res)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	return results
+}
+
+// Errors 获取所有执行失败的任务，key为任务id
+// 没有设置SetKeepResults时只能通过Err获取第一个错误
+func (q *Queue) Errors() map[int]error {
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	errs := make(map[int]error, len(q.errs))
+	for id, err := range q.errs {
+		errs[id] = err
+	}
+
+	return errs
+}
+
+// Err 获取第一个执行失败的任务的错误
+func (q *Queue) Err() error {
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	return q.firstErr
+}
+
+// reset 清空执行结果，任务id继续递增
+func (q *Queue) reset() {
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	q.results = make(map[int]Result)
+	q.errs = make(map[int]error)
+	q.firstErr = nil
+}
+
+// nextID 生成下一个任务id
+func (q *Queue) nextID() int {
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	q.seq++
+	return q.seq
+}
+
+// exec 执行单个任务，捕获任务中发生的panic
+func (q *Queue) exec(j *job) {
+	res := Result{ID: j.id}
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				res.Err = &gtask.PanicError{Value: e, Stack: grecover.CatchStack()}
+			}
+		}()
+
+		res.Value, res.Err = j.fn()
+	}()
+
+	q.resMu.Lock()
+	if q.keepResults {
+		q.results[res.ID] = res
+	}
+
+	if res.Err != nil {
+		// 不保存执行结果时只记录第一个错误，避免流式队列的errs无限增长
+		if q.keepResults {
+			q.errs[res.ID] = res.Err
+		}
+
+		if q.firstErr == nil {
+			q.firstErr = res.Err
+		}
+	}
+	q.resMu.Unlock()
+
+	// 完成一个task立即回调，发生错误时回调的结果为错误
+	if q.taskCallback != nil {
+		if res.Err != nil {
+			q.taskCallback(res.Err)
+		} else {
+			q.taskCallback(res.Value)
+		}
+	}
+
+	if q.resultCallback != nil {
+		q.resultCallback(res)
+	}
+}
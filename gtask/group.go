@@ -0,0 +1,172 @@
+package gtask
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Func 在独立携程中执行的任务函数
+type Func[T any] func(ctx context.Context) (T, error)
+
+// AllFailedError Any中所有的任务都执行失败，Errors按照任务的顺序排列
+type AllFailedError struct {
+	Errors []error
+}
+
+// Error 实现error接口
+func (e *AllFailedError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("all %d tasks failed: [%s]", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// indexed 带有任务序号的执行结果
+type indexed[T any] struct {
+	index int
+	value T
+	err   error
+}
+
+// spawn 每个fn在独立携程中执行，执行结果写入返回的chan
+// fn发生的panic会被捕获并返回*PanicError
+func spawn[T any](ctx context.Context, fns []Func[T]) <-chan indexed[T] {
+	o := newOptions(nil)
+	ch := make(chan indexed[T], len(fns))
+	for i, fn := range fns {
+		go func(i int, fn Func[T]) {
+			value, err := run(ctx, fn, o)
+			ch <- indexed[T]{index: i, value: value, err: err}
+		}(i, fn)
+	}
+
+	return ch
+}
+
+// All 并发执行所有的fn，等待全部执行成功后按照顺序返回结果
+// 任意一个fn执行失败，取消其他fn的ctx并返回该错误
+func All[T any](ctx context.Context, fns ...Func[T]) ([]T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := spawn(ctx, fns)
+	values := make([]T, len(fns))
+	for range fns {
+		res := <-ch
+		if res.err != nil {
+			return nil, res.err
+		}
+
+		values[res.index] = res.value
+	}
+
+	return values, nil
+}
+
+// Any 并发执行所有的fn，返回第一个执行成功的结果，并取消其他fn的ctx
+// 所有的fn都执行失败时返回*AllFailedError
+func Any[T any](ctx context.Context, fns ...Func[T]) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var zero T
+	if len(fns) == 0 {
+		return zero, &AllFailedError{}
+	}
+
+	ch := spawn(ctx, fns)
+	errs := make([]error, len(fns))
+	for range fns {
+		res := <-ch
+		if res.err == nil {
+			return res.value, nil
+		}
+
+		errs[res.index] = res.err
+	}
+
+	return zero, &AllFailedError{Errors: errs}
+}
+
+// Race 并发执行所有的fn，返回第一个执行完毕的结果，不论成功还是失败
+// 其他fn的ctx会被取消
+func Race[T any](ctx context.Context, fns ...Func[T]) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var zero T
+	if len(fns) == 0 {
+		return zero, &AllFailedError{}
+	}
+
+	res := <-spawn(ctx, fns)
+	return res.value, res.err
+}
+
+// ParallelMap 对items中的每个元素并发执行fn，最多同时执行limit个，按照items的顺序返回结果
+// limit小于等于0时不限制并发数，任意一个fn执行失败，取消其他fn的ctx并返回该错误
+func ParallelMap[T, R any](ctx context.Context, items []T, limit int, fn func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	if limit <= 0 || limit > len(items) {
+		limit = len(items)
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	o := newOptions([]Option{WithName(funcName(fn))})
+	values := make([]R, len(items))
+	sem := make(chan struct{}, limit)
+
+loop:
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+
+		wg.Add(1)
+		go func(i int, item T) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			value, err := run(ctx, func(ctx context.Context) (R, error) {
+				return fn(ctx, item)
+			}, o)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+
+				return
+			}
+
+			values[i] = value
+		}(i, item)
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
@@ -0,0 +1,213 @@
+package gtask
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TaskInfo 正在执行的任务信息
+type TaskInfo struct {
+	ID          int64     // 任务id
+	Name        string    // 任务名称，默认为fn的函数名
+	StartTime   time.Time // 任务开始时间
+	AbandonTime time.Time // 调用方因为超时或者取消不再等待的时间，零值表示调用方仍在等待
+	Stack       string    // 执行任务的goroutine当前的堆栈
+}
+
+// Abandoned 调用方已经返回，但是任务的goroutine仍在执行
+func (t TaskInfo) Abandoned() bool {
+	return !t.AbandonTime.IsZero()
+}
+
+// entry 注册表中的任务
+type entry struct {
+	info  TaskInfo
+	goid  int64
+	timer *time.Timer
+}
+
+// registry 记录所有正在执行的任务，用于发现没有响应ctx取消的goroutine
+type registry struct {
+	mu        sync.Mutex
+	seq       int64
+	tasks     map[int64]*entry
+	leakAfter time.Duration
+	onLeak    func(info TaskInfo)
+}
+
+var tasks = &registry{tasks: make(map[int64]*entry)}
+
+// SetLeakHandler 设置泄漏任务的回调函数
+// 调用方因为超时或者取消返回后，fn超过after时间仍然没有退出，就认为发生了泄漏，每个任务只回调一次
+// 例如：gtask.SetLeakHandler(time.Minute, func(info gtask.TaskInfo) { log.Println(info.Name, info.Stack) })
+func SetLeakHandler(after time.Duration, fn func(info TaskInfo)) {
+	tasks.mu.Lock()
+	defer tasks.mu.Unlock()
+
+	tasks.leakAfter = after
+	tasks.onLeak = fn
+}
+
+// Inflight 获取所有正在执行的任务，按照开始时间排列
+func Inflight() []TaskInfo {
+	return tasks.list(false)
+}
+
+// Leaked 获取调用方已经返回但是仍在执行的任务，按照开始时间排列
+func Leaked() []TaskInfo {
+	return tasks.list(true)
+}
+
+// list 获取正在执行的任务，abandoned为true时只返回调用方已经返回的任务
+func (r *registry) list(abandoned bool) []TaskInfo {
+	r.mu.Lock()
+	list := make([]TaskInfo, 0, len(r.tasks))
+	ids := make([]int64, 0, len(r.tasks))
+	for _, e := range r.tasks {
+		if abandoned && !e.info.Abandoned() {
+			continue
+		}
+
+		list = append(list, e.info)
+		ids = append(ids, e.goid)
+	}
+	r.mu.Unlock()
+
+	if len(list) > 0 {
+		stacks := allStacks()
+		for i := range list {
+			list[i].Stack = stacks[ids[i]]
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// track 在调用方注册一个任务，name为空时使用fn的函数名
+func track(name string, fn interface{}) *entry {
+	if name == "" {
+		name = funcName(fn)
+	}
+
+	tasks.mu.Lock()
+	defer tasks.mu.Unlock()
+
+	tasks.seq++
+	e := &entry{info: TaskInfo{ID: tasks.seq, Name: name, StartTime: time.Now()}}
+	tasks.tasks[e.info.ID] = e
+	return e
+}
+
+// bind 在执行任务的goroutine中调用，记录goroutine id用于获取堆栈
+func (e *entry) bind() {
+	id := goid()
+
+	tasks.mu.Lock()
+	e.goid = id
+	tasks.mu.Unlock()
+}
+
+// finish 任务执行完毕，从注册表中删除
+func (e *entry) finish() {
+	tasks.mu.Lock()
+	defer tasks.mu.Unlock()
+
+	delete(tasks.tasks, e.info.ID)
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+}
+
+// abandon 调用方因为超时或者取消不再等待任务
+func (e *entry) abandon() {
+	tasks.mu.Lock()
+	defer tasks.mu.Unlock()
+
+	if _, ok := tasks.tasks[e.info.ID]; !ok {
+		return
+	}
+
+	e.info.AbandonTime = time.Now()
+	if tasks.onLeak == nil {
+		return
+	}
+
+	onLeak := tasks.onLeak
+	e.timer = time.AfterFunc(tasks.leakAfter, func() {
+		tasks.mu.Lock()
+		_, ok := tasks.tasks[e.info.ID]
+		info, id := e.info, e.goid
+		tasks.mu.Unlock()
+
+		if ok {
+			info.Stack = allStacks()[id]
+			onLeak(info)
+		}
+	})
+}
+
+// funcName 获取fn的函数名
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return ""
+	}
+
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+
+	return ""
+}
+
+// goid 获取当前goroutine的id
+func goid() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+
+	id, _ := strconv.ParseInt(string(buf), 10, 64)
+	return id
+}
+
+// allStacks 获取所有goroutine的堆栈，key为goroutine id
+func allStacks() map[int64]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[int64]string)
+	for _, s := range bytes.Split(buf, []byte("\n\n")) {
+		if !bytes.HasPrefix(s, []byte("goroutine ")) {
+			continue
+		}
+
+		head := bytes.TrimPrefix(s, []byte("goroutine "))
+		if i := bytes.IndexByte(head, ' '); i > 0 {
+			if id, err := strconv.ParseInt(string(head[:i]), 10, 64); err == nil {
+				stacks[id] = string(s)
+			}
+		}
+	}
+
+	return stacks
+}
@@ -0,0 +1,137 @@
+package gtask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/daheige/thinkgo/grecover"
+)
+
+// ErrTimeout 任务执行超时
+var ErrTimeout = errors.New("task timeout")
+
+// PanicError 任务执行过程中发生了panic，包含panic的堆栈信息
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error 实现error接口
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task exec panic: %v", e.Value)
+}
+
+// options 任务执行的参数
+type options struct {
+	name         string
+	timeout      time.Duration
+	capturePanic bool
+}
+
+// Option 采用func Option功能模式为Run添加参数
+type Option func(o *options)
+
+// WithTimeout 设置任务超时时间，超时后传入fn的ctx会被取消，Run返回ErrTimeout
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithName 设置任务名称，用于Inflight和Leaked中识别任务，默认为fn的函数名
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithPanicCapture 设置是否捕获fn中发生的panic，默认捕获并返回*PanicError
+// 设置为false时，panic会在调用Run的goroutine中重新抛出
+func WithPanicCapture(capture bool) Option {
+	return func(o *options) {
+		o.capturePanic = capture
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{capturePanic: true}
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	return o
+}
+
+// Run 在独立携程中运行fn，返回fn的结果，错误以及执行耗时(单位s)
+// ctx被取消或者任务超时后，Run立即返回，fn应当监听ctx.Done()尽快退出
+func Run[T any](ctx context.Context, fn Func[T], opts ...Option) (T, error, float64) {
+	o := newOptions(opts)
+	t := time.Now()
+
+	var (
+		ctx2   context.Context
+		cancel context.CancelFunc
+	)
+
+	if o.timeout > 0 {
+		ctx2, cancel = context.WithTimeout(ctx, o.timeout)
+	} else {
+		ctx2, cancel = context.WithCancel(ctx)
+	}
+
+	defer cancel()
+
+	value, err := run(ctx2, fn, o)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		err = ErrTimeout // 外部的ctx没有被取消，说明是任务超时
+	}
+
+	return value, err, time.Since(t).Seconds()
+}
+
+// result fn的执行结果
+type result[T any] struct {
+	value T
+	err   error
+	panic *PanicError
+}
+
+// run 在独立携程中执行fn，等待fn执行完毕或者ctx被取消
+func run[T any](ctx context.Context, fn Func[T], o *options) (T, error) {
+	done := make(chan result[T], 1)
+	task := track(o.name, fn)
+	go func() {
+		task.bind()
+
+		var res result[T]
+		defer func() {
+			if e := recover(); e != nil {
+				res.panic = &PanicError{Value: e, Stack: grecover.CatchStack()}
+			}
+
+			task.finish()
+			done <- res
+		}()
+
+		res.value, res.err = fn(ctx)
+	}()
+
+	var zero T
+	select {
+	case res := <-done:
+		if res.panic != nil {
+			if !o.capturePanic {
+				panic(res.panic.Value)
+			}
+
+			return zero, res.panic
+		}
+
+		return res.value, res.err
+	case <-ctx.Done():
+		task.abandon() // fn可能没有监听ctx.Done()，记录下来便于发现泄漏的goroutine
+		return zero, ctx.Err()
+	}
+}
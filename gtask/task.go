@@ -10,7 +10,9 @@ import (
 	"time"
 )
 
-//  TaskRes task返回的结果
+// TaskRes task返回的结果
+//
+// Deprecated: use Run instead.
 type TaskRes struct {
 	Err      error
 	Result   chan interface{}
@@ -19,6 +21,8 @@ type TaskRes struct {
 
 // DoTask 在独立携程中运行fn
 // 这里返回结果设计为interface{},因为有时候返回结果可以是error
+//
+// Deprecated: use Run instead.
 func DoTask(fn func() interface{}) *TaskRes {
 	t := time.Now()
 	done := make(chan struct{}, 1)
@@ -47,6 +51,8 @@ func DoTask(fn func() interface{}) *TaskRes {
 }
 
 // DoTaskWithArgs 在独立携程中执行有参数的fn
+//
+// Deprecated: use Run instead.
 func DoTaskWithArgs(fn func(args ...interface{}) interface{}, args ...interface{}) *TaskRes {
 	t := time.Now()
 	done := make(chan struct{}, 1)
@@ -75,6 +81,8 @@ func DoTaskWithArgs(fn func(args ...interface{}) interface{}, args ...interface{
 }
 
 // DoTaskWithTimeout 采用done+select+time.After实现goroutine超时调用
+//
+// Deprecated: use Run instead.
 func DoTaskWithTimeout(fn func() interface{}, timeout time.Duration) *TaskRes {
 	t := time.Now()
 	done := make(chan struct{}, 1)
@@ -82,8 +90,11 @@ func DoTaskWithTimeout(fn func() interface{}, timeout time.Duration) *TaskRes {
 		Result: make(chan interface{}, 1),
 	}
 
+	task := track("", fn)
 	go func() {
+		task.bind()
 		defer func() {
+			task.finish()
 			close(res.Result)
 			close(done)
 			if err := recover(); err != nil {
@@ -99,6 +110,7 @@ func DoTaskWithTimeout(fn func() interface{}, timeout time.Duration) *TaskRes {
 	case <-done:
 		log.Println("task has done")
 	case <-time.After(timeout):
+		task.abandon()
 		if res.Err == nil { // 当执行过程中没有发生了panic的话，这里设置为任务超时错误
 			res.Err = errors.New("task timeout")
 		}
@@ -109,6 +121,8 @@ func DoTaskWithTimeout(fn func() interface{}, timeout time.Duration) *TaskRes {
 }
 
 // DoTaskWithContext 通过上下文context+done+select实现goroutine超时调用
+//
+// Deprecated: use Run instead.
 func DoTaskWithContext(ctx context.Context, fn func() interface{}, timeout time.Duration) *TaskRes {
 	t := time.Now()
 	done := make(chan struct{}, 1)
@@ -119,8 +133,11 @@ func DoTaskWithContext(ctx context.Context, fn func() interface{}, timeout time.
 	ctx2, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	task := track("", fn)
 	go func() {
+		task.bind()
 		defer func() {
+			task.finish()
 			close(res.Result)
 			close(done)
 			if err := recover(); err != nil {
@@ -136,6 +153,7 @@ func DoTaskWithContext(ctx context.Context, fn func() interface{}, timeout time.
 	case <-done:
 		log.Println("task has done")
 	case <-ctx2.Done(): // 超时了
+		task.abandon()
 		if res.Err == nil {
 			res.Err = errors.New("task timeout")
 		}
@@ -146,6 +164,8 @@ func DoTaskWithContext(ctx context.Context, fn func() interface{}, timeout time.
 }
 
 // DoTaskWithTimeoutArgs 采用done+select+time.After实现goroutine超时调用
+//
+// Deprecated: use Run instead.
 func DoTaskWithTimeoutArgs(fn func(args ...interface{}) interface{}, timeout time.Duration, args ...interface{}) *TaskRes {
 	t := time.Now()
 	done := make(chan struct{}, 1)
@@ -153,8 +173,11 @@ func DoTaskWithTimeoutArgs(fn func(args ...interface{}) interface{}, timeout tim
 		Result: make(chan interface{}, 1),
 	}
 
+	task := track("", fn)
 	go func() {
+		task.bind()
 		defer func() {
+			task.finish()
 			close(res.Result)
 			close(done)
 			if err := recover(); err != nil {
@@ -170,6 +193,7 @@ func DoTaskWithTimeoutArgs(fn func(args ...interface{}) interface{}, timeout tim
 	case <-done:
 		log.Println("task has done")
 	case <-time.After(timeout):
+		task.abandon()
 		if res.Err == nil {
 			res.Err = errors.New("task timeout")
 		}
@@ -180,6 +204,8 @@ func DoTaskWithTimeoutArgs(fn func(args ...interface{}) interface{}, timeout tim
 }
 
 // DoTaskWithContextArgs 通过上下文context+done+select实现goroutine超时调用
+//
+// Deprecated: use Run instead.
 func DoTaskWithContextArgs(ctx context.Context, fn func(args ...interface{}) interface{}, timeout time.Duration, args ...interface{}) *TaskRes {
 	t := time.Now()
 	done := make(chan struct{}, 1)
@@ -190,8 +216,11 @@ func DoTaskWithContextArgs(ctx context.Context, fn func(args ...interface{}) int
 	ctx2, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	task := track("", fn)
 	go func() {
+		task.bind()
 		defer func() {
+			task.finish()
 			close(res.Result)
 			close(done)
 			if err := recover(); err != nil {
@@ -207,6 +236,7 @@ func DoTaskWithContextArgs(ctx context.Context, fn func(args ...interface{}) int
 	case <-done:
 		log.Println("task has done")
 	case <-ctx2.Done(): // 超时了
+		task.abandon()
 		if res.Err == nil {
 			res.Err = ctx2.Err()
 		}
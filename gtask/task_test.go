@@ -0,0 +1,192 @@
+package gtask
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRun test typed task
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	n, err, cost := Run(ctx, func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+	log.Println("n: ", n, "err: ", err, "cost: ", cost)
+	if n != 1 || err != nil {
+		t.Fatalf("n: %d err: %v", n, err)
+	}
+
+	_, err, _ = Run(ctx, func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, WithTimeout(20*time.Millisecond))
+	if err != ErrTimeout {
+		t.Fatalf("timeout error: %v", err)
+	}
+
+	_, err, _ = Run(ctx, func(ctx context.Context) ([]int, error) {
+		var s []int
+		return s[:1], nil
+	})
+
+	var pe *PanicError
+	if !errors.As(err, &pe) || len(pe.Stack) == 0 {
+		t.Fatalf("panic error: %v", err)
+	}
+
+	ctx2, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err, _ = Run(ctx2, func(ctx context.Context) (int, error) {
+		time.Sleep(time.Second)
+		return 0, nil
+	}, WithTimeout(time.Second))
+	if err != context.Canceled {
+		t.Fatalf("cancel error: %v", err)
+	}
+
+	defer func() {
+		if e := recover(); e != "boom" {
+			t.Fatalf("recover: %v", e)
+		}
+	}()
+
+	Run(ctx, func(ctx context.Context) (int, error) {
+		panic("boom")
+	}, WithPanicCapture(false))
+}
+
+// TestGroup test All,Any,Race and ParallelMap
+func TestGroup(t *testing.T) {
+	ctx := context.Background()
+	sleep := func(d time.Duration, v int, err error) Func[int] {
+		return func(ctx context.Context) (int, error) {
+			select {
+			case <-time.After(d):
+				return v, err
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+	}
+
+	values, err := All(ctx, sleep(20*time.Millisecond, 1, nil), sleep(10*time.Millisecond, 2, nil))
+	if err != nil || len(values) != 2 || values[0] != 1 || values[1] != 2 {
+		t.Fatalf("all values: %v err: %v", values, err)
+	}
+
+	start := time.Now()
+	errFail := errors.New("fail")
+	if _, err = All(ctx, sleep(time.Second, 1, nil), sleep(10*time.Millisecond, 0, errFail)); err != errFail {
+		t.Fatalf("all error: %v", err)
+	}
+
+	if cost := time.Since(start); cost > 500*time.Millisecond {
+		t.Fatalf("all should return on first error,cost: %v", cost)
+	}
+
+	v, err := Any(ctx, sleep(5*time.Millisecond, 0, errFail), sleep(20*time.Millisecond, 3, nil), sleep(time.Second, 4, nil))
+	if v != 3 || err != nil {
+		t.Fatalf("any value: %d err: %v", v, err)
+	}
+
+	var ae *AllFailedError
+	_, err = Any(ctx, sleep(0, 0, errFail), func(ctx context.Context) (int, error) {
+		panic("any panic")
+	})
+	if !errors.As(err, &ae) || len(ae.Errors) != 2 {
+		t.Fatalf("any error: %v", err)
+	}
+
+	log.Println("any error: ", err)
+	v, err = Race(ctx, sleep(5*time.Millisecond, 0, errFail), sleep(50*time.Millisecond, 5, nil))
+	if err != errFail {
+		t.Fatalf("race value: %d err: %v", v, err)
+	}
+
+	var running, max int32
+	var mu sync.Mutex
+	items := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	res, err := ParallelMap(ctx, items, 3, func(ctx context.Context, item int) (string, error) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return strconv.Itoa(item * 2), nil
+	})
+	if err != nil || len(res) != len(items) || res[7] != "16" || max > 3 {
+		t.Fatalf("parallel map result: %v err: %v max: %d", res, err, max)
+	}
+
+	_, err = ParallelMap(ctx, items, 2, func(ctx context.Context, item int) (int, error) {
+		if item == 1 {
+			return 0, errFail
+		}
+
+		return sleep(time.Second, item, nil)(ctx)
+	})
+	if err != errFail {
+		t.Fatalf("parallel map error: %v", err)
+	}
+}
+
+// TestLeaked test leaked task registry
+func TestLeaked(t *testing.T) {
+	leaks := make(chan TaskInfo, 1)
+	SetLeakHandler(20*time.Millisecond, func(info TaskInfo) {
+		leaks <- info
+	})
+	defer SetLeakHandler(0, nil)
+
+	release := make(chan struct{})
+	_, err, _ := Run(context.Background(), func(ctx context.Context) (int, error) {
+		<-release // 没有监听ctx.Done()
+		return 0, nil
+	}, WithName("ignore-cancel"), WithTimeout(10*time.Millisecond))
+	if err != ErrTimeout {
+		t.Fatalf("timeout error: %v", err)
+	}
+
+	info := <-leaks
+	log.Println("leaked task: ", info.Name, info.StartTime, "\n", info.Stack)
+	if info.Name != "ignore-cancel" || !info.Abandoned() || !strings.Contains(info.Stack, "TestLeaked") {
+		t.Fatalf("leaked task: %+v", info)
+	}
+
+	tracked := func(list []TaskInfo) bool {
+		for _, v := range list {
+			if v.ID == info.ID {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if !tracked(Leaked()) {
+		t.Fatalf("leaked list: %+v", Leaked())
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for tracked(Inflight()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("inflight: %+v", Inflight())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
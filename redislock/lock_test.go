@@ -1,9 +1,11 @@
 package redislock
 
 import (
+	"context"
 	"log"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -55,6 +57,55 @@ func TestLock(t *testing.T) {
 	log.Println("ok")
 }
 
+// TestLockWatchdog 测试阻塞加锁和看门狗自动续期
+func TestLockWatchdog(t *testing.T) {
+	conn, err := redis.Dial("tcp", "localhost:6379")
+	if err != nil {
+		t.Skip("redis connection error: ", err)
+	}
+
+	defer conn.Close()
+
+	conn2, err := redis.Dial("tcp", "localhost:6379")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn2.Close()
+
+	l := NewLock(conn, "heige:watchdog", WithExpire(300*time.Millisecond), WithWatchdog(100*time.Millisecond))
+	if err := l.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过过期时间后，看门狗续期保证锁仍然被持有
+	time.Sleep(500 * time.Millisecond)
+	l2 := NewLock(conn2, "heige:watchdog", WithExpire(300*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := l2.Lock(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("lock error: %v", err)
+	}
+
+	// 模拟锁被删除，看门狗续期失败后关闭Lost
+	conn2.Do("DEL", "heige:watchdog")
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock lost should be closed")
+	}
+
+	if err := l2.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Renew(); err != ErrLockNotHeld {
+		t.Fatalf("renew error: %v", err)
+	}
+
+	l2.Unlock()
+}
+
 /**
 2019/08/10 23:36:13 lock fail
 2019/08/10 23:36:13 err:  <nil>
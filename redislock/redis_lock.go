@@ -1,17 +1,60 @@
 package redislock
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"time"
+
 	"github.com/gomodule/redigo/redis"
 )
 
 var DefaultExpire = 10 // 加锁的key默认过期时间，单位s
 
+// ErrLockNotHeld 锁已经过期或者被其他client持有
+var ErrLockNotHeld = errors.New("redislock: lock not held")
+
 // Lock lock data.
 type Lock struct {
-	conn   redis.Conn  // redis连接句柄，支持redis pool连接句柄
-	expire int         // 设置加锁key的过期时间
-	key    string      // 加锁的key
-	val    interface{} // 加锁的value
+	conn       redis.Conn    // redis连接句柄，支持redis pool连接句柄
+	expire     int           // 设置加锁key的过期时间
+	key        string        // 加锁的key
+	val        interface{}   // 加锁的value
+	ttl        time.Duration // 加锁key的过期时间，精确到毫秒
+	minBackoff time.Duration // Lock重试的最小间隔时间
+	maxBackoff time.Duration // Lock重试的最大间隔时间
+	watchdog   time.Duration // 看门狗续期的间隔时间，0表示不自动续期
+	mu         sync.Mutex    // redis.Conn不支持并发调用，保护conn,lost,stop
+	lost       chan struct{} // 持有的锁丢失后关闭，需要开启看门狗
+	stop       chan struct{} // 释放锁后关闭，停止看门狗
+}
+
+// Option 采用func Option功能模式为Lock添加参数
+type Option func(lock *Lock)
+
+// WithExpire 设置加锁key的过期时间，默认DefaultExpire秒
+func WithExpire(ttl time.Duration) Option {
+	return func(lock *Lock) {
+		lock.ttl = ttl
+	}
+}
+
+// WithBackoff 设置Lock重试的间隔时间，从min开始每次翻倍，最大为max，默认50ms~1s
+func WithBackoff(min, max time.Duration) Option {
+	return func(lock *Lock) {
+		lock.minBackoff = min
+		lock.maxBackoff = max
+	}
+}
+
+// WithWatchdog 设置看门狗续期的间隔时间，默认为过期时间的1/3，小于等于0表示不自动续期
+func WithWatchdog(interval time.Duration) Option {
+	return func(lock *Lock) {
+		lock.watchdog = interval
+	}
 }
 
 // New 实例化redis分布式锁实例对象
@@ -20,12 +63,73 @@ func New(conn redis.Conn, key string, val interface{}, expire int) *Lock {
 		expire = DefaultExpire
 	}
 
-	return &Lock{
+	lock := &Lock{
 		key:    key,
 		conn:   conn,
 		val:    val,
 		expire: expire,
+		ttl:    time.Duration(expire) * time.Second,
+	}
+
+	lock.init()
+	return lock
+}
+
+// NewLock 实例化redis分布式锁实例对象，自动生成随机的value作为锁的持有者标识
+// 加锁成功后默认开启看门狗，在持有锁期间定期续期，释放锁后停止
+func NewLock(conn redis.Conn, key string, opts ...Option) *Lock {
+	lock := &Lock{
+		key:  key,
+		conn: conn,
+		val:  newToken(),
+		ttl:  time.Duration(DefaultExpire) * time.Second,
+	}
+
+	lock.watchdog = -1
+	for _, o := range opts {
+		o(lock)
+	}
+
+	if lock.ttl <= 0 {
+		lock.ttl = time.Duration(DefaultExpire) * time.Second
+	}
+
+	if lock.watchdog < 0 {
+		lock.watchdog = lock.ttl / 3
+	}
+
+	lock.init()
+	return lock
+}
+
+// init 设置默认参数
+func (lock *Lock) init() {
+	if lock.minBackoff <= 0 {
+		lock.minBackoff = 50 * time.Millisecond
 	}
+
+	if lock.maxBackoff < lock.minBackoff {
+		lock.maxBackoff = time.Second
+		if lock.maxBackoff < lock.minBackoff {
+			lock.maxBackoff = lock.minBackoff
+		}
+	}
+
+	lock.lost = make(chan struct{})
+}
+
+// Value 获取锁的持有者标识
+func (lock *Lock) Value() interface{} {
+	return lock.val
+}
+
+// Lost 返回一个chan，看门狗发现持有的锁因为过期或者被其他client获得而丢失时关闭
+// 每次加锁成功后都会返回新的chan，没有开启看门狗时不会关闭
+func (lock *Lock) Lost() <-chan struct{} {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	return lock.lost
 }
 
 // delScript lua脚本删除一个key保证原子性，采用lua脚本执行
@@ -39,17 +143,149 @@ end`)
 
 // Unlock 释放锁采用redis lua脚步执行，成功返回nil
 func (lock *Lock) Unlock() error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	if lock.stop != nil {
+		close(lock.stop)
+		lock.stop = nil
+	}
+
 	_, err := delScript.Do(lock.conn, lock.key, lock.val)
 	return err
 }
 
 // TryLock 尝试加锁,如果加锁成功就返回true,nil
 // 利用redis setEx nx的原子性实现分布式锁
+// 锁被其他client持有时返回false,nil
 func (lock *Lock) TryLock() (bool, error) {
-	_, err := redis.String(lock.conn.Do("SET", lock.key, lock.val, "EX", lock.expire, "NX"))
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	_, err := redis.String(lock.conn.Do("SET", lock.key, lock.val, "PX", lock.ttl.Milliseconds(), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
 	if err != nil {
 		return false, err
 	}
 
+	lock.lost = make(chan struct{})
+	if lock.watchdog > 0 && lock.stop == nil {
+		lock.stop = make(chan struct{})
+		go lock.watch(lock.stop)
+	}
+
 	return true, nil
 }
+
+// Lock 加锁，锁被其他client持有时按照退避时间重试，直到加锁成功或者ctx被取消
+func (lock *Lock) Lock(ctx context.Context) error {
+	backoff := lock.minBackoff
+	var timer *time.Timer
+	for {
+		ok, err := lock.TryLock()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		// 增加随机抖动，避免多个client同时重试
+		wait := backoff/2 + time.Duration(mrand.Int63n(int64(backoff/2)+1))
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		} else {
+			timer.Reset(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > lock.maxBackoff {
+			backoff = lock.maxBackoff
+		}
+	}
+}
+
+// renewScript lua脚本续期，只有value一致时才重新设置过期时间
+var renewScript = redis.NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end`)
+
+// Renew 对已经持有的锁续期，重新设置过期时间
+// 锁已经过期或者被其他client持有时返回ErrLockNotHeld
+func (lock *Lock) Renew() error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	return lock.renew()
+}
+
+// renew 调用方需要持有lock.mu
+func (lock *Lock) renew() error {
+	n, err := redis.Int(renewScript.Do(lock.conn, lock.key, lock.val, lock.ttl.Milliseconds()))
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+// watch 看门狗，持有锁期间定期续期，锁丢失后关闭lost
+// redis连接错误时在下一个周期重试，锁过期之后续期会返回ErrLockNotHeld
+func (lock *Lock) watch(stop chan struct{}) {
+	ticker := time.NewTicker(lock.watchdog)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		lock.mu.Lock()
+		select {
+		case <-stop:
+			lock.mu.Unlock()
+			return
+		default:
+		}
+
+		err := lock.renew()
+		if err == ErrLockNotHeld {
+			close(lock.lost)
+			lock.stop = nil
+			lock.mu.Unlock()
+			return
+		}
+
+		lock.mu.Unlock()
+	}
+}
+
+// newToken 生成随机的锁持有者标识
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+
+	return hex.EncodeToString(b)
+}
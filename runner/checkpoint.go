@@ -0,0 +1,187 @@
+package runner
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Checkpoint 检查点存储接口，记录每次运行中已经执行成功的任务id
+// 运行被中断后，下一次以Resume模式启动时跳过已经执行成功的任务
+type Checkpoint interface {
+	// Load 获取key对应的已经执行成功的任务id
+	Load(key string) ([]int, error)
+
+	// Save 记录key对应的任务id执行成功
+	Save(key string, id int) error
+
+	// Clear 所有的任务都执行成功后，清除key对应的检查点
+	Clear(key string) error
+}
+
+// FileCheckpoint 基于本地文件的检查点存储
+// 每个key对应dir目录下的一个文件，每一行记录一个执行成功的任务id
+type FileCheckpoint struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileCheckpoint 创建基于本地文件的检查点存储，dir不存在时自动创建
+func NewFileCheckpoint(dir string) (*FileCheckpoint, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileCheckpoint{dir: dir}, nil
+}
+
+// filename key对应的检查点文件
+func (c *FileCheckpoint) filename(key string) string {
+	return filepath.Join(c.dir, url.PathEscape(key)+".checkpoint")
+}
+
+// Load 获取key对应的已经执行成功的任务id，检查点文件不存在时返回空
+func (c *FileCheckpoint) Load(key string) ([]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.Open(c.filename(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var ids []int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// 写入一半的行直接忽略，对应的任务会重新执行
+		id, err := strconv.Atoi(line)
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, scanner.Err()
+}
+
+// Save 追加记录key对应的任务id执行成功
+func (c *FileCheckpoint) Save(key string, id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.OpenFile(c.filename(key), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.WriteString(strconv.Itoa(id) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Clear 删除key对应的检查点文件
+func (c *FileCheckpoint) Clear(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := os.Remove(c.filename(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// WithCheckpoint 设置检查点，key用于区分不同的运行，比如job名称
+// 每个任务执行成功后记录到检查点中，所有任务执行成功后清除检查点
+// store为nil时使用系统临时目录下runner目录中的文件存储
+func WithCheckpoint(key string, store Checkpoint) Option {
+	return func(r *Runner) {
+		r.checkpointKey = key
+		r.checkpoint = store
+	}
+}
+
+// WithResume 开启Resume模式，启动时跳过检查点中已经执行成功的任务
+// 需要配合WithCheckpoint一起使用
+func WithResume() Option {
+	return func(r *Runner) {
+		r.resume = true
+	}
+}
+
+// initCheckpoint 初始化默认的检查点存储
+func (r *Runner) initCheckpoint() {
+	if r.checkpointKey == "" || r.checkpoint != nil {
+		return
+	}
+
+	store, err := NewFileCheckpoint(filepath.Join(os.TempDir(), "runner"))
+	if err != nil {
+		r.logger.Println("create file checkpoint error: ", err)
+		return
+	}
+
+	r.checkpoint = store
+}
+
+// completed 获取检查点中已经执行成功的任务id
+func (r *Runner) completed() map[int]bool {
+	if !r.resume || r.checkpoint == nil {
+		return nil
+	}
+
+	ids, err := r.checkpoint.Load(r.checkpointKey)
+	if err != nil {
+		r.logger.Println("load checkpoint error: ", err)
+		return nil
+	}
+
+	m := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		m[id] = true
+	}
+
+	return m
+}
+
+// saveCheckpoint 记录任务执行成功
+func (r *Runner) saveCheckpoint(id int) {
+	if r.checkpoint == nil {
+		return
+	}
+
+	if err := r.checkpoint.Save(r.checkpointKey, id); err != nil {
+		r.logger.Println("save checkpoint error: ", err)
+	}
+}
+
+// clearCheckpoint 所有任务执行成功后清除检查点
+func (r *Runner) clearCheckpoint() {
+	if r.checkpoint == nil {
+		return
+	}
+
+	if err := r.checkpoint.Clear(r.checkpointKey); err != nil {
+		r.logger.Println("clear checkpoint error: ", err)
+	}
+}
@@ -0,0 +1,354 @@
+// The cron spec parser and the Next algorithm are derived from robfig/cron v3
+// (https://github.com/robfig/cron),which is distributed under the MIT license:
+//
+// Copyright (C) 2012 Rob Figueiredo
+// All Rights Reserved.
+//
+// MIT LICENSE
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 任务调度计划
+type Schedule interface {
+	// Next 返回t之后的下一次执行时间
+	Next(t time.Time) time.Time
+}
+
+// bounds cron表达式每个字段的取值范围
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	seconds = bounds{0, 59, nil}
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	dom     = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 星期天可以用0或者7表示，解析范围之后7会被合并到0
+	dow = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// starBit 表示字段为*，用于日和星期的匹配规则
+const starBit = 1 << 63
+
+// cronSchedule 标准cron表达式的调度计划
+// 每个字段采用bit位表示可以执行的值
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+}
+
+// everySchedule 固定间隔的调度计划，例如 @every 1m30s
+type everySchedule struct {
+	interval time.Duration
+}
+
+// Next 实现Schedule接口
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(e.interval)
+}
+
+// ParseSchedule 解析cron表达式
+// 支持标准的5个字段(分 时 日 月 星期)或者6个字段(秒 分 时 日 月 星期)
+// 每个字段支持 * , - / 以及月份和星期的英文缩写，例如: */5 * * * MON-FRI
+// 同时支持 @yearly @monthly @weekly @daily @hourly 以及 @every 1h30m 这样的固定间隔
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty cron spec")
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		return parseDescriptor(spec)
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields,found %d: %s", len(fields), spec)
+	}
+
+	s := &cronSchedule{}
+	var err error
+	for k, v := range []struct {
+		bits *uint64
+		b    bounds
+	}{
+		{&s.second, seconds},
+		{&s.minute, minutes},
+		{&s.hour, hours},
+		{&s.dom, dom},
+		{&s.month, months},
+		{&s.dow, dow},
+	} {
+		if *v.bits, err = parseField(fields[k], v.b); err != nil {
+			return nil, fmt.Errorf("parse cron spec %s error: %v", spec, err)
+		}
+	}
+
+	return s, nil
+}
+
+// parseDescriptor 解析@开头的预定义调度计划
+func parseDescriptor(spec string) (Schedule, error) {
+	switch spec {
+	case "@yearly", "@annually":
+		return ParseSchedule("0 0 0 1 1 *")
+	case "@monthly":
+		return ParseSchedule("0 0 0 1 * *")
+	case "@weekly":
+		return ParseSchedule("0 0 0 * * 0")
+	case "@daily", "@midnight":
+		return ParseSchedule("0 0 0 * * *")
+	case "@hourly":
+		return ParseSchedule("0 0 * * * *")
+	}
+
+	const every = "@every "
+	if strings.HasPrefix(spec, every) {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len(every):]))
+		if err != nil {
+			return nil, fmt.Errorf("parse cron spec %s error: %v", spec, err)
+		}
+
+		if d <= 0 {
+			return nil, fmt.Errorf("parse cron spec %s error: interval must be positive", spec)
+		}
+
+		return everySchedule{interval: d}, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized cron descriptor: %s", spec)
+}
+
+// parseField 解析cron表达式的一个字段，返回对应的bit位
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		v, err := parseRange(expr, b)
+		if err != nil {
+			return 0, err
+		}
+
+		bits |= v
+	}
+
+	return bits, nil
+}
+
+// parseRange 解析 * 或 a 或 a-b 以及带步长的 */n a-b/n a/n
+func parseRange(expr string, b bounds) (uint64, error) {
+	var (
+		start, end, step uint
+		err              error
+		extra            uint64
+	)
+
+	rangeAndStep := strings.Split(expr, "/")
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("invalid range: %s", expr)
+		}
+
+		start, end = b.min, b.max
+		extra = starBit
+	} else {
+		if start, err = parseValue(lowAndHigh[0], b); err != nil {
+			return 0, err
+		}
+
+		switch len(lowAndHigh) {
+		case 1:
+			end = start
+		case 2:
+			if end, err = parseValue(lowAndHigh[1], b); err != nil {
+				return 0, err
+			}
+
+			// 星期的范围以SUN结尾时表示7，例如 MON-SUN
+			if b.max == dow.max && end == 0 && start > 0 {
+				end = dow.max
+			}
+		default:
+			return 0, fmt.Errorf("invalid range: %s", expr)
+		}
+	}
+
+	switch len(rangeAndStep) {
+	case 1:
+		step = 1
+	case 2:
+		n, err := strconv.ParseUint(rangeAndStep[1], 10, 32)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("invalid step: %s", expr)
+		}
+
+		step = uint(n)
+
+		// a/n 表示从a开始到最大值
+		if len(lowAndHigh) == 1 && extra == 0 {
+			end = b.max
+		}
+
+		if step > 1 {
+			extra = 0
+		}
+	default:
+		return 0, fmt.Errorf("invalid step: %s", expr)
+	}
+
+	if start < b.min || end > b.max || start > end {
+		return 0, fmt.Errorf("value out of range [%d,%d]: %s", b.min, b.max, expr)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+
+	// 范围展开之后再将星期的7合并到0，保证 5-7 这样的范围可以通过检查
+	if b.max == dow.max && bits&(1<<dow.max) > 0 {
+		bits = bits&^(1<<dow.max) | 1<<dow.min
+	}
+
+	return bits | extra, nil
+}
+
+// parseValue 解析数字或者英文缩写
+func parseValue(s string, b bounds) (uint, error) {
+	if b.names != nil {
+		if v, ok := b.names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: %s", s)
+	}
+
+	return uint(n), nil
+}
+
+// Next 实现Schedule接口，返回t之后满足cron表达式的下一次执行时间
+// 如果5年之内都没有满足条件的时间，返回零值
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+	yearLimit := t.Year() + 5
+
+	added := false
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+
+		t = t.AddDate(0, 0, 1)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t
+}
+
+// dayMatches 日和星期的匹配规则和标准cron保持一致
+// 如果日和星期都不是*，满足其中之一即可，否则需要同时满足
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow > 0
+	if s.dom&starBit > 0 || s.dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
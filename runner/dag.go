@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrCycle 任务依赖关系中存在环
+	ErrCycle = errors.New("task dependency cycle detected")
+
+	// ErrDependencyFailed 依赖的任务执行失败或被跳过，当前任务被跳过
+	ErrDependencyFailed = errors.New("task dependency failed")
+)
+
+// node 任务图中的一个节点
+type node struct {
+	id   int                             // 任务id,即任务添加的顺序,和GetAllErrors的key保持一致
+	name string                          // 任务名称
+	fn   func(ctx context.Context) error // 执行的任务func
+	deps []string                        // 依赖的任务名称，依赖的任务成功后才会执行当前任务
+	prev int                             // 通过Add添加的前一个任务id,仅保证执行顺序,-1表示没有
+
+	timeout time.Duration // 任务超时时间，0表示使用runner的WithTaskTimeout
+	retry   int           // 任务失败后的重试次数，-1表示使用runner的WithRetry
+}
+
+// graph 任务依赖图
+type graph struct {
+	nodes      []*node
+	requires   [][]int // 每个任务依赖的任务id,依赖任务必须执行成功
+	dependents [][]int // 依赖当前任务的任务id
+	indegree   []int   // 每个任务未完成的前置任务个数
+}
+
+// buildGraph 根据任务依赖关系构建任务图，并检测依赖是否存在以及是否有环
+func buildGraph(nodes []*node) (*graph, error) {
+	n := len(nodes)
+	g := &graph{
+		nodes:      nodes,
+		requires:   make([][]int, n),
+		dependents: make([][]int, n),
+		indegree:   make([]int, n),
+	}
+
+	names := make(map[string]int, n)
+	for _, v := range nodes {
+		if v.name == "" {
+			continue
+		}
+
+		if _, ok := names[v.name]; ok {
+			return nil, fmt.Errorf("duplicate task name: %s", v.name)
+		}
+
+		names[v.name] = v.id
+	}
+
+	for _, v := range nodes {
+		if v.prev >= 0 {
+			g.dependents[v.prev] = append(g.dependents[v.prev], v.id)
+			g.indegree[v.id]++
+		}
+
+		for _, dep := range v.deps {
+			k, ok := names[dep]
+			if !ok {
+				return nil, fmt.Errorf("task %s dependency not found: %s", v.name, dep)
+			}
+
+			g.requires[v.id] = append(g.requires[v.id], k)
+			g.dependents[k] = append(g.dependents[k], v.id)
+			g.indegree[v.id]++
+		}
+	}
+
+	// 采用kahn算法检测是否存在环
+	indegree := make([]int, n)
+	copy(indegree, g.indegree)
+
+	queue := make([]int, 0, n)
+	for k := range indegree {
+		if indegree[k] == 0 {
+			queue = append(queue, k)
+		}
+	}
+
+	visited := 0
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		visited++
+
+		for _, d := range g.dependents[k] {
+			indegree[d]--
+			if indegree[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	if visited < n {
+		return nil, ErrCycle
+	}
+
+	return g, nil
+}
@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/daheige/thinkgo/redislock"
+)
+
+var (
+	// ErrLockHeld 分布式锁被其他实例持有，本次运行被跳过
+	ErrLockHeld = errors.New("runner lock is held by other instance")
+
+	// ErrLockLost 运行过程中分布式锁续期失败，正在执行的任务被取消
+	ErrLockLost = errors.New("runner lock is lost")
+)
+
+// Locker 分布式锁接口，redislock.Lock实现了该接口
+// 同一个job部署在多台机器上时，通过分布式锁保证同一时刻只有一个实例在运行
+type Locker interface {
+	// TryLock 尝试加锁，锁被其他实例持有时返回false,nil
+	TryLock() (bool, error)
+
+	// Renew 对已经持有的锁续期，锁已经丢失时返回redislock.ErrLockNotHeld
+	Renew() error
+
+	// Unlock 释放锁
+	Unlock() error
+}
+
+// WithLocker 设置分布式锁，Start之前先加锁，运行结束后释放锁
+// renew 为锁续期的间隔时间，应当小于锁的过期时间，小于等于0表示不续期
+// 锁丢失或者超过锁的过期时间仍然没有续期成功时，取消正在执行的任务，Start返回ErrLockLost
+func WithLocker(l Locker, renew time.Duration) Option {
+	return func(r *Runner) {
+		r.locker = l
+		r.lockRenew = renew
+	}
+}
+
+// WithLockTTL 设置锁的过期时间，续期发生网络错误时会一直重试，直到超过过期时间
+// 默认为续期间隔时间的3倍
+func WithLockTTL(ttl time.Duration) Option {
+	return func(r *Runner) {
+		r.lockTTL = ttl
+	}
+}
+
+// WithLockWait 设置锁被其他实例持有时的等待时间，每隔interval尝试加锁一次
+// 默认不等待，锁被其他实例持有时Start直接返回ErrLockHeld
+func WithLockWait(wait time.Duration, interval time.Duration) Option {
+	return func(r *Runner) {
+		r.lockWait = wait
+		r.lockInterval = interval
+	}
+}
+
+// lock 加锁，在lockWait时间内没有获得锁返回ErrLockHeld
+func (r *Runner) lock() error {
+	interval := r.lockInterval
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	deadline := time.Now().Add(r.lockWait)
+	for {
+		ok, err := r.locker.TryLock()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return ErrLockHeld
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// keepLock 定期对锁续期，直到ctx被取消
+// 锁已经丢失，或者超过锁的过期时间仍然没有续期成功时，
+// 设置lost标记并调用cancel取消正在执行的任务，其他错误在下一个周期重试
+func (r *Runner) keepLock(ctx context.Context, cancel context.CancelFunc, lost *int32) {
+	if r.lockRenew <= 0 {
+		return
+	}
+
+	ttl := r.lockTTL
+	if ttl <= 0 {
+		ttl = 3 * r.lockRenew
+	}
+
+	ticker := time.NewTicker(r.lockRenew)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.locker.Renew()
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+
+		r.logger.Println("renew runner lock error: ", err)
+		if errors.Is(err, redislock.ErrLockNotHeld) || time.Since(renewed) >= ttl {
+			atomic.StoreInt32(lost, 1)
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/daheige/thinkgo/gtask"
+)
+
+// TaskStatus 任务执行状态
+type TaskStatus string
+
+const (
+	// StatusPending 任务还没有开始执行
+	StatusPending TaskStatus = "pending"
+
+	// StatusRunning 任务正在执行
+	StatusRunning TaskStatus = "running"
+
+	// StatusOK 任务执行成功
+	StatusOK TaskStatus = "ok"
+
+	// StatusFailed 任务执行失败
+	StatusFailed TaskStatus = "failed"
+
+	// StatusPanicked 任务执行过程中发生了panic
+	StatusPanicked TaskStatus = "panicked"
+
+	// StatusSkipped 任务因为依赖任务失败或者快速失败而被跳过
+	StatusSkipped TaskStatus = "skipped"
+
+	// StatusInterrupted 任务因为接收到中断信号或者runner超时而被中断
+	StatusInterrupted TaskStatus = "interrupted"
+
+	// StatusResumed 任务在上一次运行中已经执行成功，Resume模式下不再执行
+	StatusResumed TaskStatus = "resumed"
+)
+
+// TaskResult 每个任务的执行结果
+type TaskResult struct {
+	ID        int        `json:"id"`              // 任务id
+	Name      string     `json:"name,omitempty"`  // 任务名称
+	Status    TaskStatus `json:"status"`          // 任务执行状态
+	Err       error      `json:"-"`               // 任务执行的错误
+	Error     string     `json:"error,omitempty"` // 任务执行的错误信息
+	Stack     string     `json:"stack,omitempty"` // 任务panic的堆栈信息
+	Attempts  int        `json:"attempts"`        // 任务执行的次数，包括重试
+	StartTime time.Time  `json:"start_time"`      // 任务开始时间
+	EndTime   time.Time  `json:"end_time"`        // 任务结束时间
+	CostTime  float64    `json:"cost_time"`       // 任务执行耗时，单位s
+}
+
+// RunReport 一次运行的执行报告
+type RunReport struct {
+	StartTime time.Time    `json:"start_time"`      // 开始时间
+	EndTime   time.Time    `json:"end_time"`        // 结束时间
+	CostTime  float64      `json:"cost_time"`       // 执行耗时，单位s
+	Status    TaskStatus   `json:"status"`          // ok,failed,interrupted,skipped
+	Error     string       `json:"error,omitempty"` // Start返回的错误信息
+	Tasks     []TaskResult `json:"tasks"`           // 每个任务的执行结果
+}
+
+// JSON 将执行报告序列化为json
+func (rp *RunReport) JSON() ([]byte, error) {
+	return json.Marshal(rp)
+}
+
+// WriteFile 将执行报告以json格式写入文件，例如写入到日志目录中
+func (rp *RunReport) WriteFile(filename string) error {
+	b, err := json.MarshalIndent(rp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
+// Report 获取最近一次运行的执行报告，Start之前调用返回nil
+func (r *Runner) Report() *RunReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.report
+}
+
+// taskStatus 根据任务的错误判断任务的执行状态
+// ctx为runner的上下文，被取消说明任务是被中断的
+func taskStatus(ctx context.Context, err error) TaskStatus {
+	if err == nil {
+		return StatusOK
+	}
+
+	var pe *gtask.PanicError
+	if errors.As(err, &pe) {
+		return StatusPanicked
+	}
+
+	if err == ErrDependencyFailed {
+		return StatusSkipped
+	}
+
+	if ctx.Err() != nil && (err == context.Canceled || err == ctx.Err()) {
+		return StatusInterrupted
+	}
+
+	return StatusFailed
+}
+
+// start 记录任务开始执行
+func (r *Runner) start(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastTaskId = id
+	res := r.results[id]
+	res.Status = StatusRunning
+	res.StartTime = time.Now()
+}
+
+// attempt 记录任务执行的次数
+func (r *Runner) attempt(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results[id].Attempts++
+}
+
+// record 记录任务执行的结果
+func (r *Runner) record(id int, err error, status TaskStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := r.results[id]
+	res.Err = err
+	res.Status = status
+	if !res.StartTime.IsZero() {
+		res.EndTime = time.Now()
+		res.CostTime = res.EndTime.Sub(res.StartTime).Seconds()
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+		r.allErrors[id] = err
+	}
+
+	var pe *gtask.PanicError
+	if errors.As(err, &pe) {
+		res.Stack = string(pe.Stack)
+	}
+}
+
+// finishRun 运行结束后生成执行报告
+// 没有执行完成的任务标记为被中断
+func (r *Runner) finishRun(start time.Time, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rp := &RunReport{
+		StartTime: start,
+		EndTime:   time.Now(),
+		Status:    StatusOK,
+		Tasks:     make([]TaskResult, 0, len(r.results)),
+	}
+
+	rp.CostTime = rp.EndTime.Sub(rp.StartTime).Seconds()
+	if err != nil {
+		rp.Error = err.Error()
+		rp.Status = StatusFailed
+		switch err {
+		case ErrInterrupt, ErrorTimeout, ErrLockLost:
+			rp.Status = StatusInterrupted
+		case ErrLockHeld:
+			rp.Status = StatusSkipped
+		}
+	}
+
+	for _, res := range r.results {
+		task := *res
+		if task.Status == StatusPending || task.Status == StatusRunning {
+			task.Status = StatusInterrupted
+			if err == ErrLockHeld {
+				task.Status = StatusSkipped
+			}
+		}
+
+		if task.Status != StatusOK && task.Status != StatusResumed && rp.Status == StatusOK {
+			rp.Status = StatusFailed
+		}
+
+		rp.Tasks = append(rp.Tasks, task)
+	}
+
+	r.report = rp
+}
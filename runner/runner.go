@@ -13,13 +13,18 @@ runner 包可用于展示如何使用通道来监视程序的执行时间,如果
 package runner
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/daheige/thinkgo/grecover"
+	"github.com/daheige/thinkgo/gtask"
 )
 
 var (
@@ -34,14 +39,30 @@ type Logger interface {
 
 // Runner 声明一个runner
 type Runner struct {
-	complete   chan error       // 有缓冲通道，存放所有任务运行后的结果状态
-	tasks      []func() error   // 执行的任务func,如果func没有错误返回，可以返回nil
-	timeout    time.Duration    // 所有的任务超时时间
-	timeCh     <-chan time.Time // 任务超时通道
-	logger     Logger           // 日志输出实例
-	interrupt  chan os.Signal   // 可以控制强制终止的信号
-	allErrors  map[int]error    // 发生错误的task index对应的错误
-	lastTaskId int              // 最后一次完成的任务id
+	tasks         []*node          // 执行的任务,如果func没有错误返回，可以返回nil
+	lastAdd       int              // 最后一个通过Add添加的任务id
+	concurrency   int              // 并行执行任务的最大个数，默认为1
+	policy        FailurePolicy    // 任务失败后的处理策略，默认为Continue
+	retry         int              // 任务失败后的重试次数
+	taskTimeout   time.Duration    // 每个任务的超时时间
+	timeout       time.Duration    // 所有的任务超时时间
+	timeCh        <-chan time.Time // 任务超时通道
+	logger        Logger           // 日志输出实例
+	interrupt     chan os.Signal   // 可以控制强制终止的信号
+	mu            sync.Mutex       // 保护allErrors,results,lastTaskId
+	allErrors     map[int]error    // 发生错误的task index对应的错误
+	results       []*TaskResult    // 每个任务的执行结果
+	report        *RunReport       // 最近一次运行的执行报告
+	locker        Locker           // 分布式锁，保证多个实例中只有一个在运行
+	lockRenew     time.Duration    // 锁续期的间隔时间
+	lockTTL       time.Duration    // 锁的过期时间
+	lockWait      time.Duration    // 锁被其他实例持有时的等待时间
+	lockInterval  time.Duration    // 等待锁时尝试加锁的间隔时间
+	checkpoint    Checkpoint       // 检查点存储
+	checkpointKey string           // 检查点的key
+	resume        bool             // 是否跳过检查点中已经执行成功的任务
+	lastTaskId    int              // 最后一次完成的任务id
+	noSignal      bool             // Start时不监听系统信号，由调用方通过interrupt通知中断
 }
 
 // Option 采用func Option功能模式为Runner添加参数
@@ -51,8 +72,9 @@ type Option func(r *Runner)
 // 默认创建一个无超时任务的runner
 func New(opts ...Option) *Runner {
 	r := &Runner{
-		complete:  make(chan error, 1),
-		interrupt: make(chan os.Signal, 1), // 声明一个中断信号
+		interrupt:   make(chan os.Signal, 1), // 声明一个中断信号
+		lastAdd:     -1,
+		concurrency: 1,
 	}
 
 	// 初始化option
@@ -64,6 +86,8 @@ func New(opts ...Option) *Runner {
 		r.logger = log.New(os.Stdout, "", log.LstdFlags)
 	}
 
+	r.initCheckpoint()
+
 	return r
 }
 
@@ -81,69 +105,444 @@ func WithLogger(l Logger) Option {
 	}
 }
 
+// FailurePolicy 任务失败后的处理策略
+type FailurePolicy int
+
+const (
+	// Continue 任务失败后继续执行其他任务，默认策略
+	Continue FailurePolicy = iota
+
+	// FailFast 任务失败后不再执行其他任务，并取消正在执行的任务
+	FailFast
+)
+
+// WithFailurePolicy 设置任务失败后的处理策略
+func WithFailurePolicy(policy FailurePolicy) Option {
+	return func(r *Runner) {
+		r.policy = policy
+	}
+}
+
+// WithRetry 设置任务失败后的重试次数，重试之后仍然失败的话按照FailurePolicy处理
+func WithRetry(n int) Option {
+	return func(r *Runner) {
+		r.retry = n
+	}
+}
+
+// WithTaskTimeout 设置每个任务的超时时间
+// 任务超时后，传入任务的ctx会被取消，runner不再等待该任务，继续执行其他任务
+func WithTaskTimeout(d time.Duration) Option {
+	return func(r *Runner) {
+		r.taskTimeout = d
+	}
+}
+
+// TaskOption 采用func Option功能模式为任务添加参数
+type TaskOption func(n *node)
+
+// DependsOn 设置任务依赖的任务名称
+func DependsOn(names ...string) TaskOption {
+	return func(n *node) {
+		n.deps = append(n.deps, names...)
+	}
+}
+
+// Timeout 设置当前任务的超时时间，覆盖WithTaskTimeout
+func Timeout(d time.Duration) TaskOption {
+	return func(n *node) {
+		n.timeout = d
+	}
+}
+
+// Retry 设置当前任务失败后的重试次数，覆盖WithRetry
+func Retry(times int) TaskOption {
+	return func(n *node) {
+		n.retry = times
+	}
+}
+
+// WithConcurrency 设置并行执行任务的最大个数
+// 没有依赖关系的任务可以并行执行，默认为1
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		if n > 0 {
+			r.concurrency = n
+		}
+	}
+}
+
+// WithoutSignal 设置Start时不监听系统信号
+// 由Scheduler驱动时，系统信号由Scheduler统一处理，AddJob会自动设置该选项
+func WithoutSignal() Option {
+	return func(r *Runner) {
+		r.noSignal = true
+	}
+}
+
 // Add 将需要执行的任务添加到r.tasks队列中
+// 通过Add添加的任务按照添加的顺序依次执行
 func (r *Runner) Add(tasks ...func() error) {
-	r.tasks = append(r.tasks, tasks...)
+	for _, task := range tasks {
+		r.addNode(withoutContext(task), "", nil)
+	}
 }
 
-// run 运行一个个任务,如果出错就返回错误信息
-func (r *Runner) run() (err error) {
-	for k, task := range r.tasks {
-		r.lastTaskId = k
+// AddWithContext 添加需要ctx的任务，按照添加的顺序依次执行
+// ctx在任务超时或者runner停止时被取消
+func (r *Runner) AddWithContext(tasks ...func(ctx context.Context) error) {
+	for _, task := range tasks {
+		r.addNode(task, "", nil)
+	}
+}
+
+// AddNamed 添加一个具名任务，deps为依赖的任务名称
+// 所有依赖的任务执行成功后才会执行当前任务，否则当前任务会被跳过
+// 没有依赖关系的任务可以并行执行，并行个数由WithConcurrency设置
+func (r *Runner) AddNamed(name string, task func() error, deps ...string) {
+	r.addNode(withoutContext(task), name, []TaskOption{DependsOn(deps...)})
+}
+
+// AddNamedWithContext 添加一个需要ctx的具名任务，通过TaskOption设置依赖关系，超时时间等
+func (r *Runner) AddNamedWithContext(name string, task func(ctx context.Context) error, opts ...TaskOption) {
+	r.addNode(task, name, opts)
+}
+
+// addNode 添加一个任务节点，没有名称的任务按照添加顺序执行
+func (r *Runner) addNode(task func(ctx context.Context) error, name string, opts []TaskOption) {
+	n := &node{
+		id:    len(r.tasks),
+		name:  name,
+		fn:    task,
+		prev:  -1,
+		retry: -1,
+	}
+
+	for _, o := range opts {
+		o(n)
+	}
+
+	if name == "" {
+		n.prev = r.lastAdd
+		r.lastAdd = n.id
+	}
+
+	r.tasks = append(r.tasks, n)
+}
+
+// withoutContext 将不需要ctx的任务转换为需要ctx的任务
+func withoutContext(task func() error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return task()
+	}
+}
+
+// run 按照任务依赖关系执行任务,如果出错就返回错误信息
+// 没有依赖关系的任务最多并行执行r.concurrency个
+func (r *Runner) run(ctx context.Context) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, err := buildGraph(r.tasks)
+	if err != nil {
+		r.logger.Println("build task graph error: ", err)
+		return err
+	}
+
+	type result struct {
+		id  int
+		err error
+	}
+
+	n := len(g.nodes)
+	completed := r.completed()
+	indegree := g.indegree
+	failed := make([]bool, n)
+	done := make(chan result, n)
+	ready := make([]int, 0, n)
+	for k := range indegree {
+		if indegree[k] == 0 {
+			ready = append(ready, k)
+		}
+	}
 
-		if r.isInterrupt() {
-			err = ErrInterrupt
-			return
+	// finish 任务完成后，将后续可以执行的任务加入ready队列
+	finish := func(id int) {
+		for _, d := range g.dependents[id] {
+			indegree[d]--
+			if indegree[d] == 0 {
+				ready = append(ready, d)
+			}
 		}
+	}
 
-		r.logger.Println("current run task id: ", k)
+	running := 0
+	interrupted := false
+	var firstErr error
+	for {
+		for !interrupted && firstErr == nil && ctx.Err() == nil && len(ready) > 0 && running < r.concurrency {
+			id := ready[0]
+			ready = ready[1:]
+
+			if r.isInterrupt() {
+				interrupted = true
+				break
+			}
+
+			// 依赖的任务执行失败，跳过当前任务
+			skip := false
+			for _, k := range g.requires[id] {
+				if failed[k] {
+					skip = true
+					break
+				}
+			}
+
+			if skip {
+				failed[id] = true
+				r.logger.Println("current task skipped: ", id, g.nodes[id].name)
+				r.record(id, ErrDependencyFailed, StatusSkipped)
+				finish(id)
+				continue
+			}
+
+			// 上一次运行中已经执行成功的任务
+			if completed[id] {
+				r.logger.Println("current task resumed: ", id, g.nodes[id].name)
+				r.record(id, nil, StatusResumed)
+				finish(id)
+				continue
+			}
+
+			r.start(id)
+			r.logger.Println("current run task id: ", id)
+
+			running++
+			go func(id int) {
+				done <- result{id: id, err: r.exec(ctx, g.nodes[id])}
+			}(id)
+		}
 
-		err = r.doTask(task)
+		if running == 0 {
+			break
+		}
+
+		res := <-done
+		running--
+
+		err = res.err
 		if err != nil {
+			failed[res.id] = true
 			r.logger.Println("current task exec occur error: ", err)
-			r.allErrors[k] = err
+
+			// 快速失败，取消正在执行的任务
+			if r.policy == FailFast && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}
+
+		if err == nil {
+			r.saveCheckpoint(res.id)
+		}
+
+		r.record(res.id, err, taskStatus(ctx, err))
+		finish(res.id)
+	}
+
+	if interrupted {
+		return ErrInterrupt
+	}
+
+	if firstErr != nil {
+		// 快速失败后没有执行的任务标记为跳过
+		for id := range g.nodes {
+			if r.status(id) == StatusPending {
+				r.record(id, nil, StatusSkipped)
+			}
+		}
+
+		return firstErr
+	}
+
+	// 所有的任务都执行成功，下一次运行从头开始
+	ok := true
+	for id := range failed {
+		if failed[id] {
+			ok = false
+			break
+		}
+	}
+
+	if ok {
+		r.clearCheckpoint()
+	}
+
+	return err
+}
+
+// exec 执行任务，任务失败后按照重试次数进行重试
+func (r *Runner) exec(ctx context.Context, n *node) (err error) {
+	retry := n.retry
+	if retry < 0 {
+		retry = r.retry
+	}
+
+	timeout := n.timeout
+	if timeout <= 0 {
+		timeout = r.taskTimeout
+	}
+
+	for i := 0; i <= retry; i++ {
+		if i > 0 {
+			r.logger.Println("current task retry: ", n.id, "times: ", i)
+		}
+
+		r.attempt(n.id)
+		err = r.doTask(ctx, n.fn, timeout)
+		if err == nil || ctx.Err() != nil {
+			return err
 		}
 	}
 
-	return
+	return err
+}
+
+// status 获取任务的执行状态
+func (r *Runner) status(id int) TaskStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.results[id].Status
 }
 
 // doTask 执行每个task，需要捕获每个任务是否出现了panic异常
 // 防止一些个别任务出现了panic,从而导致整个tasks执行全部退出
-func (r *Runner) doTask(task func() error) (err error) {
-	defer func() {
-		if e := recover(); e != nil {
-			r.logger.Println("current task throw panic: ", e)
-			err = fmt.Errorf("current task panic: %v", e)
-		}
-	}()
+// 任务超时或ctx被取消后不再等待任务完成，直接返回ctx的错误
+func (r *Runner) doTask(ctx context.Context, task func(ctx context.Context) error, timeout time.Duration) (err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				r.logger.Println("current task throw panic: ", e)
+				done <- &gtask.PanicError{Value: e, Stack: grecover.CatchStack()}
+			}
+		}()
 
-	err = task()
+		done <- task(ctx)
+	}()
 
-	return
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // GetAllErrors 获取已经完成任务的error
+// 因依赖任务失败而跳过的任务，对应的错误为ErrDependencyFailed
 func (r *Runner) GetAllErrors() map[int]error {
-	return r.allErrors
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	errs := make(map[int]error, len(r.allErrors))
+	for k, err := range r.allErrors {
+		errs[k] = err
+	}
+
+	return errs
+}
+
+// GetResults 获取每个任务的执行结果，按照任务id排列
+func (r *Runner) GetResults() []TaskResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]TaskResult, 0, len(r.results))
+	for _, res := range r.results {
+		results = append(results, *res)
+	}
+
+	return results
 }
 
 // GetLastTaskId 获取最后一次完成任务id
 func (r *Runner) GetLastTaskId() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	return r.lastTaskId
 }
 
 // Start 开始执行所有的任务
 func (r *Runner) Start() error {
-	// 接收系统退出信号
-	signal.Notify(r.interrupt, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+	// 接收系统退出信号，Start返回后恢复信号的默认处理，避免两次运行之间的信号被吞掉
+	if !r.noSignal {
+		signal.Notify(r.interrupt, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+		defer signal.Stop(r.interrupt)
+	}
 
+	r.mu.Lock()
 	r.allErrors = make(map[int]error, len(r.tasks)+1)
+	r.results = make([]*TaskResult, 0, len(r.tasks))
+	for _, v := range r.tasks {
+		r.results = append(r.results, &TaskResult{ID: v.id, Name: v.name, Status: StatusPending})
+	}
+	r.mu.Unlock()
+
+	start := time.Now()
+
+	// 多实例部署时，只有获得锁的实例才执行任务
+	if r.locker != nil {
+		if err := r.lock(); err != nil {
+			r.logger.Println("acquire runner lock error: ", err)
+			r.finishRun(start, err)
+			return err
+		}
+
+		defer func() {
+			if err := r.locker.Unlock(); err != nil {
+				r.logger.Println("release runner lock error: ", err)
+			}
+		}()
+	}
 
 	if r.timeout > 0 {
 		r.timeCh = time.After(r.timeout)
 	}
 
+	// 超时后取消正在执行的任务
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 锁续期失败后取消正在执行的任务
+	var lost int32
+	if r.locker != nil {
+		renewCtx, stopRenew := context.WithCancel(ctx)
+		renewDone := make(chan struct{})
+		go func() {
+			r.keepLock(renewCtx, cancel, &lost)
+			close(renewDone)
+		}()
+
+		// 等待续期的goroutine退出之后再释放锁，避免Renew和Unlock并发执行
+		defer func() {
+			stopRenew()
+			<-renewDone
+		}()
+	}
+
+	// 有缓冲通道，存放所有任务运行后的结果状态
+	// 每次Start使用独立的通道，避免和上一次运行的goroutine共享状态
+	complete := make(chan error, 1)
+
 	// 执行完毕的信号量
 	done := make(chan struct{}, 1)
 
@@ -157,16 +556,27 @@ func (r *Runner) Start() error {
 			close(done)
 		}()
 
-		r.complete <- r.run()
+		complete <- r.run(ctx)
 	}()
 
 	select {
 	case <-r.timeCh:
+		// 取消正在执行的任务，等待执行任务的goroutine退出后再返回
+		// 避免上一次运行的结果写入下一次Start的执行报告
+		cancel()
+		<-done
+
 		r.logger.Println(ErrorTimeout)
+		r.finishRun(start, ErrorTimeout)
 		return ErrorTimeout
 	case <-done:
-		err := <-r.complete
+		err := <-complete
+		if atomic.LoadInt32(&lost) == 1 {
+			err = ErrLockLost
+		}
+
 		r.logger.Println("task complete status: ", err)
+		r.finishRun(start, err)
 		return err
 	}
 }
@@ -1,10 +1,19 @@
 package runner
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/daheige/thinkgo/gtask"
+	"github.com/daheige/thinkgo/redislock"
 )
 
 // TestRunner test runner
@@ -31,6 +40,248 @@ func TestRunner(t *testing.T) {
 	log.Println("all error: ", p.GetAllErrors())
 }
 
+// TestRunnerDAG test runner with task dependencies
+func TestRunnerDAG(t *testing.T) {
+	std := log.New(os.Stdout, "[runner] ", log.LstdFlags)
+	p := New(WithLogger(std), WithConcurrency(2))
+
+	sleepTask := func(name string) func() error {
+		return func() error {
+			log.Println("load ", name)
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}
+	}
+
+	p.AddNamed("A", sleepTask("A"))
+	p.AddNamed("B", sleepTask("B"))
+	p.AddNamed("C", func() error {
+		log.Println("C depends on A and B")
+		return nil
+	}, "A", "B")
+	p.AddNamed("E", func() error {
+		return errors.New("E failed")
+	})
+	p.AddNamed("D", func() error {
+		return nil
+	}, "E")
+
+	start := time.Now()
+	err := p.Start()
+	log.Println("error: ", err, "cost: ", time.Since(start))
+	if cost := time.Since(start); cost > 180*time.Millisecond {
+		t.Fatalf("A and B should run in parallel,cost: %v", cost)
+	}
+
+	errs := p.GetAllErrors()
+	log.Println("all error: ", errs)
+	if len(errs) != 2 || errs[4] != ErrDependencyFailed {
+		t.Fatalf("all errors: %v", errs)
+	}
+
+	for _, res := range p.GetResults() {
+		log.Printf("task result: %+v", res)
+		if res.Name == "C" && (res.Status != StatusOK || res.Err != nil) {
+			t.Fatalf("task C result: %+v", res)
+		}
+
+		if res.Name == "D" && res.Status != StatusSkipped {
+			t.Fatalf("task D result: %+v", res)
+		}
+	}
+
+	// 检测依赖关系中的环
+	p = New(WithLogger(std))
+	p.AddNamed("A", sleepTask("A"), "B")
+	p.AddNamed("B", sleepTask("B"), "A")
+	if err := p.Start(); err != ErrCycle {
+		t.Fatalf("cycle error: %v", err)
+	}
+}
+
+// TestParseSchedule test cron spec parse
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2020, 5, 23, 20, 30, 5, 0, time.Local)
+	for _, v := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, 5, 23, 20, 31, 0, 0, time.Local)},
+		{"*/15 * * * * *", time.Date(2020, 5, 23, 20, 30, 15, 0, time.Local)},
+		{"0 2 * * *", time.Date(2020, 5, 24, 2, 0, 0, 0, time.Local)},
+		{"30 9 * * MON-FRI", time.Date(2020, 5, 25, 9, 30, 0, 0, time.Local)},
+		{"0 0 1,15 * *", time.Date(2020, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"0 9 * * 5-7", time.Date(2020, 5, 24, 9, 0, 0, 0, time.Local)},
+		{"0 9 * * MON-SUN", time.Date(2020, 5, 24, 9, 0, 0, 0, time.Local)},
+		{"0 9 * * 7", time.Date(2020, 5, 24, 9, 0, 0, 0, time.Local)},
+		{"0 9 * * 1-5", time.Date(2020, 5, 25, 9, 0, 0, 0, time.Local)},
+		{"@daily", time.Date(2020, 5, 24, 0, 0, 0, 0, time.Local)},
+		{"@every 1m30s", base.Add(90 * time.Second)},
+	} {
+		schedule, err := ParseSchedule(v.spec)
+		if err != nil {
+			t.Fatalf("parse spec %s error: %v", v.spec, err)
+		}
+
+		if next := schedule.Next(base); !next.Equal(v.next) {
+			t.Fatalf("spec %s next: %v,expected: %v", v.spec, next, v.next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * *", "60 * * * *", "*/0 * * * *", "0 9 * * 8", "@every -1s", "@unknown"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("parse invalid spec %s should return error", spec)
+		}
+	}
+}
+
+// TestScheduler test runner scheduler
+func TestScheduler(t *testing.T) {
+	std := log.New(os.Stdout, "[scheduler] ", log.LstdFlags)
+
+	var runs int32
+	r := New(WithLogger(std))
+	r.Add(func() error {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(120 * time.Millisecond)
+		return nil
+	})
+
+	var missed int32
+	s := NewScheduler(WithSchedulerLogger(std), WithMissedFunc(func(name string, scheduled time.Time) {
+		atomic.AddInt32(&missed, 1)
+	}))
+
+	if err := s.AddJob("test", "@every 50ms", r); err != nil {
+		t.Fatalf("add job error: %v", err)
+	}
+
+	s.Start()
+	time.Sleep(420 * time.Millisecond)
+	s.Stop()
+
+	log.Println("runs: ", runs, "missed: ", missed)
+	if runs < 2 || missed == 0 || int64(missed) != s.Missed("test") {
+		t.Fatalf("runs: %d missed: %d", runs, missed)
+	}
+
+	// 系统信号由调度器处理，正在执行的Runner被中断，调度器停止调度
+	started := make(chan struct{})
+	var once sync.Once
+	r = New(WithLogger(std))
+	r.Add(func() error {
+		once.Do(func() {
+			close(started)
+		})
+
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}, createTask(1))
+
+	s = NewScheduler(WithSchedulerLogger(std))
+	if err := s.AddJob("signal", "@every 20ms", r); err != nil {
+		t.Fatalf("add job error: %v", err)
+	}
+
+	s.Start()
+	<-started
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("send signal error: %v", err)
+	}
+
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("scheduler does not stop after signal")
+	}
+
+	s.Stop()
+	if rp := r.Report(); rp == nil || rp.Status != StatusInterrupted || rp.Error != ErrInterrupt.Error() {
+		t.Fatalf("interrupted run report: %+v", rp)
+	}
+}
+
+// TestRunnerPolicy test failure policy,retry and task timeout
+func TestRunnerPolicy(t *testing.T) {
+	std := log.New(os.Stdout, "[runner] ", log.LstdFlags)
+
+	// 快速失败，后续任务不再执行
+	var runs int32
+	errTask := errors.New("task error")
+	p := New(WithLogger(std), WithFailurePolicy(FailFast))
+	p.Add(func() error {
+		return errTask
+	}, func() error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+
+	if err := p.Start(); err != errTask || runs != 0 {
+		t.Fatalf("fail fast error: %v runs: %d", err, runs)
+	}
+
+	// 任务失败后重试
+	var attempts int32
+	p = New(WithLogger(std), WithRetry(2))
+	p.Add(func() error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return errTask
+		}
+
+		return nil
+	})
+
+	if err := p.Start(); err != nil || attempts != 3 || len(p.GetAllErrors()) != 0 {
+		t.Fatalf("retry error: %v attempts: %d", err, attempts)
+	}
+
+	// 单个任务超时不会占用全部的执行时间
+	p = New(WithLogger(std), WithTimeout(time.Second), WithTaskTimeout(50*time.Millisecond))
+	p.AddNamedWithContext("hung", func(ctx context.Context) error {
+		select {} // 忽略ctx的任务
+	})
+	p.AddNamedWithContext("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, Timeout(100*time.Millisecond), Retry(0))
+	p.AddNamedWithContext("next", func(ctx context.Context) error {
+		return nil
+	}, DependsOn("hung"))
+
+	start := time.Now()
+	err := p.Start()
+	log.Println("error: ", err, "cost: ", time.Since(start), "all error: ", p.GetAllErrors())
+	if cost := time.Since(start); cost > 500*time.Millisecond {
+		t.Fatalf("task timeout does not work,cost: %v", cost)
+	}
+
+	errs := p.GetAllErrors()
+	if errs[0] != context.DeadlineExceeded || errs[1] != context.DeadlineExceeded || errs[2] != ErrDependencyFailed {
+		t.Fatalf("task timeout errors: %v", errs)
+	}
+
+	// 整体超时后等待正在执行的任务退出，再次Start不会和上一次运行的goroutine竞争
+	p = New(WithLogger(std), WithTimeout(50*time.Millisecond))
+	p.AddNamedWithContext("wait", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	p.AddNamedWithContext("next", func(ctx context.Context) error {
+		return nil
+	}, DependsOn("wait"))
+
+	for i := 0; i < 2; i++ {
+		if err := p.Start(); err != ErrorTimeout {
+			t.Fatalf("run timeout error: %v", err)
+		}
+
+		rp := p.Report()
+		if rp.Status != StatusInterrupted || rp.Tasks[0].Status != StatusInterrupted || rp.Tasks[1].Status != StatusInterrupted {
+			t.Fatalf("run timeout report: %+v", rp)
+		}
+	}
+}
+
 // createTask 创建任务
 func createTask(id int) func() error {
 	return func() error {
@@ -42,6 +293,270 @@ func createTask(id int) func() error {
 	}
 }
 
+// TestRunReport test run report
+func TestRunReport(t *testing.T) {
+	p := New(WithLogger(log.New(os.Stderr, "", log.LstdFlags)))
+	p.AddNamed("A", func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	p.AddNamed("B", func() error {
+		panic("b panic")
+	}, "A")
+	p.AddNamed("C", func() error {
+		return nil
+	}, "B")
+
+	if p.Report() != nil {
+		t.Fatal("report should be nil before start")
+	}
+
+	err := p.Start()
+	var pe *gtask.PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("start error: %v", err)
+	}
+
+	rp := p.Report()
+	if rp == nil || rp.Status != StatusFailed || len(rp.Tasks) != 3 {
+		t.Fatalf("report: %+v", rp)
+	}
+
+	want := []TaskStatus{StatusOK, StatusPanicked, StatusSkipped}
+	for i, task := range rp.Tasks {
+		if task.Status != want[i] {
+			t.Fatalf("task %s status: %s", task.Name, task.Status)
+		}
+	}
+
+	if rp.Tasks[0].CostTime < 0.02 || rp.Tasks[0].Attempts != 1 {
+		t.Fatalf("task A: %+v", rp.Tasks[0])
+	}
+
+	if rp.Tasks[1].Stack == "" || rp.Tasks[1].Error == "" {
+		t.Fatalf("task B: %+v", rp.Tasks[1])
+	}
+
+	b, err := rp.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("report: ", string(b))
+	filename := filepath.Join(t.TempDir(), "report.json")
+	if err := rp.WriteFile(filename); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// memLocker 内存中实现的Locker，用于模拟多个实例竞争同一把锁
+type memLocker struct {
+	mu     *sync.Mutex
+	holder *string
+	id     string
+	renew  int32
+	lost   bool
+	flaky  int32 // 续期时返回网络错误的次数，小于0表示一直返回错误
+}
+
+func (l *memLocker) TryLock() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if *l.holder != "" {
+		return false, nil
+	}
+
+	*l.holder = l.id
+	return true, nil
+}
+
+func (l *memLocker) Renew() error {
+	n := atomic.AddInt32(&l.renew, 1)
+	if l.flaky < 0 || n <= l.flaky {
+		return errors.New("connection reset")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lost || *l.holder != l.id {
+		return redislock.ErrLockNotHeld
+	}
+
+	return nil
+}
+
+func (l *memLocker) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if *l.holder == l.id {
+		*l.holder = ""
+	}
+
+	return nil
+}
+
+// TestRunnerLocker test singleton execution across instances
+func TestRunnerLocker(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		holder string
+		runs   int32
+	)
+
+	newRunner := func(id string, opts ...Option) (*Runner, *memLocker) {
+		l := &memLocker{mu: &mu, holder: &holder, id: id}
+		opts = append(opts, WithLocker(l, 10*time.Millisecond), WithLogger(log.New(os.Stderr, id+" ", log.LstdFlags)))
+		r := New(opts...)
+		r.Add(func() error {
+			atomic.AddInt32(&runs, 1)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})
+
+		return r, l
+	}
+
+	r1, l1 := newRunner("r1")
+	r2, _ := newRunner("r2")
+	errs := make(chan error, 2)
+	go func() { errs <- r1.Start() }()
+	time.Sleep(10 * time.Millisecond)
+	go func() { errs <- r2.Start() }()
+
+	if err := <-errs; err != ErrLockHeld {
+		t.Fatalf("second instance error: %v", err)
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("first instance error: %v", err)
+	}
+
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("runs: %d", n)
+	}
+
+	if atomic.LoadInt32(&l1.renew) == 0 || holder != "" {
+		t.Fatalf("renew: %d holder: %s", l1.renew, holder)
+	}
+
+	if rp := r2.Report(); rp.Status != StatusSkipped || rp.Tasks[0].Status != StatusSkipped {
+		t.Fatalf("report: %+v", rp)
+	}
+
+	// 等待锁释放之后执行
+	r1, _ = newRunner("r1")
+	r2, _ = newRunner("r2", WithLockWait(time.Second, 10*time.Millisecond))
+	go func() { errs <- r1.Start() }()
+	time.Sleep(10 * time.Millisecond)
+	go func() { errs <- r2.Start() }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("wait lock error: %v", err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&runs); n != 3 {
+		t.Fatalf("runs: %d", n)
+	}
+
+	// 续期失败后取消任务
+	r := New(WithLocker(&memLocker{mu: &mu, holder: &holder, id: "r3", lost: true}, 10*time.Millisecond))
+	r.AddWithContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := r.Start(); err != ErrLockLost {
+		t.Fatalf("lock lost error: %v", err)
+	}
+
+	// 续期的网络错误在过期时间内重试，不会取消任务
+	r = New(WithLocker(&memLocker{mu: &mu, holder: &holder, id: "r4", flaky: 2}, 10*time.Millisecond))
+	r.Add(func() error {
+		time.Sleep(80 * time.Millisecond)
+		return nil
+	})
+
+	if err := r.Start(); err != nil {
+		t.Fatalf("flaky renew error: %v", err)
+	}
+
+	// 超过过期时间仍然没有续期成功，认为锁已经丢失
+	r = New(WithLocker(&memLocker{mu: &mu, holder: &holder, id: "r5", flaky: -1}, 10*time.Millisecond), WithLockTTL(30*time.Millisecond))
+	r.AddWithContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := r.Start(); err != ErrLockLost {
+		t.Fatalf("renew timeout error: %v", err)
+	}
+}
+
+// TestRunnerResume test checkpoint and resume
+func TestRunnerResume(t *testing.T) {
+	store, err := NewFileCheckpoint(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var runs [4]int32
+	fail := int32(1)
+	newRunner := func() *Runner {
+		r := New(WithCheckpoint("job/resume", store), WithResume(), WithFailurePolicy(FailFast))
+		for i := 0; i < 4; i++ {
+			i := i
+			r.Add(func() error {
+				atomic.AddInt32(&runs[i], 1)
+				if i == 2 && atomic.LoadInt32(&fail) == 1 {
+					return errors.New("task 2 error")
+				}
+
+				return nil
+			})
+		}
+
+		return r
+	}
+
+	if err := newRunner().Start(); err == nil {
+		t.Fatal("first run should fail")
+	}
+
+	ids, err := store.Load("job/resume")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("checkpoint ids: %v error: %v", ids, err)
+	}
+
+	atomic.StoreInt32(&fail, 0)
+	r := newRunner()
+	if err := r.Start(); err != nil {
+		t.Fatalf("resume error: %v", err)
+	}
+
+	for i, want := range []int32{1, 1, 2, 1} {
+		if runs[i] != want {
+			t.Fatalf("task %d runs: %d", i, runs[i])
+		}
+	}
+
+	if res := r.GetResults(); res[0].Status != StatusResumed || res[3].Status != StatusOK {
+		t.Fatalf("results: %+v", res)
+	}
+
+	if r.Report().Status != StatusOK {
+		t.Fatalf("report: %+v", r.Report())
+	}
+
+	// 全部执行成功后检查点被清除
+	if ids, _ := store.Load("job/resume"); len(ids) != 0 {
+		t.Fatalf("checkpoint not cleared: %v", ids)
+	}
+}
+
 /**
 2020/05/23 20:30:05 正在执行任务19997
 [runner] 2020/05/23 20:30:05 current run task id:  19998
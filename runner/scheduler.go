@@ -0,0 +1,252 @@
+package runner
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrSchedulerStarted 调度器已经启动，不能再添加任务
+var ErrSchedulerStarted = errors.New("scheduler has been started")
+
+// MissedFunc 错过执行时的回调函数
+// name为job名称，scheduled为计划执行的时间
+// 当上一次执行还没有完成，或者调度器被阻塞导致错过执行时间时调用
+type MissedFunc func(name string, scheduled time.Time)
+
+// Scheduler 按照cron表达式定时执行Runner
+// 同一个job的上一次执行没有完成时，本次执行会被跳过，防止重复执行
+// 系统信号由Scheduler统一处理，收到信号后中断正在执行的Runner并停止调度
+type Scheduler struct {
+	logger    Logger
+	missed    MissedFunc
+	jobs      []*job
+	stop      chan struct{}
+	stopOnce  sync.Once
+	interrupt chan os.Signal // 可以控制强制终止的信号
+	wg        sync.WaitGroup
+	started   bool
+	mu        sync.Mutex
+}
+
+// job 调度器中的一个定时任务
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	runner   *Runner
+	running  int32 // 是否正在执行
+	missed   int64 // 错过执行的次数
+}
+
+// SchedulerOption 采用func Option功能模式为Scheduler添加参数
+type SchedulerOption func(s *Scheduler)
+
+// WithSchedulerLogger 设置调度器日志输出实例
+func WithSchedulerLogger(l Logger) SchedulerOption {
+	return func(s *Scheduler) {
+		s.logger = l
+	}
+}
+
+// WithMissedFunc 设置错过执行时的回调函数
+func WithMissedFunc(fn MissedFunc) SchedulerOption {
+	return func(s *Scheduler) {
+		s.missed = fn
+	}
+}
+
+// NewScheduler 创建一个调度器
+func NewScheduler(opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		stop:      make(chan struct{}),
+		interrupt: make(chan os.Signal, 1),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	if s.logger == nil {
+		s.logger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	return s
+}
+
+// AddJob 添加一个定时执行的Runner，spec为cron表达式，参考ParseSchedule
+// Runner的Start不再监听系统信号，由调度器统一处理
+func (s *Scheduler) AddJob(name string, spec string, r *Runner) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrSchedulerStarted
+	}
+
+	r.noSignal = true
+	s.jobs = append(s.jobs, &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		runner:   r,
+	})
+
+	return nil
+}
+
+// Start 启动调度器，每个job在独立的goroutine中调度
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+
+	s.started = true
+
+	// 接收系统退出信号
+	signal.Notify(s.interrupt, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+	s.wg.Add(1)
+	go s.watch()
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.schedule(j)
+	}
+}
+
+// Done 返回调度器停止时关闭的通道，收到系统信号或者调用Stop之后关闭
+func (s *Scheduler) Done() <-chan struct{} {
+	return s.stop
+}
+
+// watch 监听系统信号，收到信号后通知正在执行的Runner中断，然后停止调度
+// 停止之后恢复信号的默认处理，再次收到信号时进程可以正常退出
+func (s *Scheduler) watch() {
+	defer s.wg.Done()
+	defer signal.Stop(s.interrupt)
+
+	select {
+	case sg := <-s.interrupt:
+		s.logger.Println("scheduler received signal: ", sg.String())
+		for _, j := range s.jobs {
+			if atomic.LoadInt32(&j.running) == 1 {
+				select {
+				case j.runner.interrupt <- sg:
+				default:
+				}
+			}
+		}
+
+		s.shutdown()
+	case <-s.stop:
+	}
+}
+
+// shutdown 关闭s.stop，通知所有job停止调度
+func (s *Scheduler) shutdown() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// Stop 停止调度器，并等待正在执行的Runner完成
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	s.shutdown()
+	s.wg.Wait()
+}
+
+// Missed 返回job错过执行的次数
+func (s *Scheduler) Missed(name string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.name == name {
+			return atomic.LoadInt64(&j.missed)
+		}
+	}
+
+	return 0
+}
+
+// schedule 按照调度计划执行job
+func (s *Scheduler) schedule(j *job) {
+	defer s.wg.Done()
+
+	next := j.schedule.Next(time.Now())
+	for {
+		if next.IsZero() {
+			s.logger.Println("job: ", j.name, "has no next exec time,spec: ", j.spec)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			s.trigger(j, next)
+
+			// 调度被阻塞导致错过的执行时间
+			next = j.schedule.Next(next)
+			for !next.IsZero() && !next.After(now) {
+				s.miss(j, next)
+				next = j.schedule.Next(next)
+			}
+		}
+	}
+}
+
+// trigger 执行job,如果上一次执行还没有完成，本次执行被跳过
+func (s *Scheduler) trigger(j *job, scheduled time.Time) {
+	if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+		s.miss(j, scheduled)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				s.logger.Println("job: ", j.name, "exec panic: ", e)
+			}
+
+			atomic.StoreInt32(&j.running, 0)
+			s.wg.Done()
+		}()
+
+		s.logger.Println("job: ", j.name, "begin run,scheduled at: ", scheduled)
+		err := j.runner.Start()
+		s.logger.Println("job: ", j.name, "run complete status: ", err)
+	}()
+}
+
+// miss 记录并回调错过的执行
+func (s *Scheduler) miss(j *job, scheduled time.Time) {
+	atomic.AddInt64(&j.missed, 1)
+	s.logger.Println("job: ", j.name, "missed exec scheduled at: ", scheduled)
+	if s.missed != nil {
+		s.missed(j.name, scheduled)
+	}
+}
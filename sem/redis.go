@@ -0,0 +1,236 @@
+package sem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrLeaseExpired 释放或者续期时租约已经过期，被其他持有者清除
+var ErrLeaseExpired = errors.New("semaphore: lease expired")
+
+// acquireScript 删除已经过期的租约，租约个数小于tickets时写入新的租约
+// 使用redis的时间，避免多台机器之间的时钟误差
+// key的过期时间只会延长，避免有效期较短的实例缩短其他实例持有的较长租约
+// KEYS[1]: 有序集合 ARGV[1]: token ARGV[2]: tickets ARGV[3]: 租约的有效期，单位ms
+var acquireScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("zremrangebyscore", KEYS[1], "-inf", now)
+if redis.call("zcard", KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call("zadd", KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+	if redis.call("pttl", KEYS[1]) < tonumber(ARGV[3]) then
+		redis.call("pexpire", KEYS[1], ARGV[3])
+	end
+	return 1
+end
+return 0`)
+
+// refreshScript 租约存在时延长有效期，key的过期时间同样只会延长
+var refreshScript = redis.NewScript(`
+redis.replicate_commands()
+if not redis.call("zscore", KEYS[1], ARGV[1]) then
+	return 0
+end
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("zadd", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+if redis.call("pttl", KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 1`)
+
+var _ SemInterface = (*RedisSemaphore)(nil)
+
+// RedisSemaphore 基于redis有序集合实现的分布式信号量，多个进程共享tickets个资源
+// 每次获取时以随机token作为member，租约的过期时间作为score写入有序集合
+// 持有者崩溃后租约过期，其他持有者获取时会清除过期的租约，从而自动释放资源
+type RedisSemaphore struct {
+	client   redis.Cmdable
+	key      string
+	tickets  int
+	timeout  time.Duration // acquire timeout
+	ttl      time.Duration // 租约的有效期
+	interval time.Duration // 获取失败后重试的间隔时间
+	mu       sync.Mutex
+	tokens   []string // 当前实例持有的租约
+}
+
+// RedisOption 采用func Option功能模式为RedisSemaphore添加参数
+type RedisOption func(s *RedisSemaphore)
+
+// WithLeaseTTL 设置租约的有效期，默认30s，持有时间超过有效期时需要调用Refresh续期
+func WithLeaseTTL(ttl time.Duration) RedisOption {
+	return func(s *RedisSemaphore) {
+		s.ttl = ttl
+	}
+}
+
+// WithRetryInterval 设置获取失败后重试的间隔时间，默认50ms
+func WithRetryInterval(d time.Duration) RedisOption {
+	return func(s *RedisSemaphore) {
+		s.interval = d
+	}
+}
+
+// NewRedis 创建基于redis的分布式信号量，key为有序集合的key，tickets为资源的总数
+// timeout为Acquire的超时时间，超时后返回ErrNoTickets，与New的语义一致
+func NewRedis(client redis.Cmdable, key string, tickets int, timeout time.Duration, opts ...RedisOption) *RedisSemaphore {
+	s := &RedisSemaphore{
+		client:   client,
+		key:      key,
+		tickets:  tickets,
+		timeout:  timeout,
+		ttl:      30 * time.Second,
+		interval: 50 * time.Millisecond,
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// Acquire 获取一个资源，超过timeout仍然没有获取到时返回ErrNoTickets
+func (s *RedisSemaphore) Acquire() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	err := s.AcquireContext(ctx)
+	if err == context.DeadlineExceeded {
+		return ErrNoTickets
+	}
+
+	return err
+}
+
+// AcquireContext 获取一个资源，阻塞直到获取成功或者ctx被取消
+func (s *RedisSemaphore) AcquireContext(ctx context.Context) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	var timer *time.Timer
+	for {
+		ok, err := acquireScript.Run(s.client, []string{s.key}, token, s.tickets, s.ttl.Milliseconds()).Bool()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			s.mu.Lock()
+			s.tokens = append(s.tokens, token)
+			s.mu.Unlock()
+			return nil
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(s.interval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(s.interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Release 释放最早获取的一个资源
+// 没有获取资源时返回ErrIllegalRelease，租约已经过期时返回ErrLeaseExpired
+func (s *RedisSemaphore) Release() error {
+	s.mu.Lock()
+	if len(s.tokens) == 0 {
+		s.mu.Unlock()
+		return ErrIllegalRelease
+	}
+
+	token := s.tokens[0]
+	s.tokens = s.tokens[1:]
+	s.mu.Unlock()
+
+	n, err := s.client.ZRem(s.key, token).Result()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrLeaseExpired
+	}
+
+	return nil
+}
+
+// Refresh 延长当前实例持有的所有租约的有效期，持有时间较长时需要定期调用
+// 已经过期的租约会被丢弃并返回ErrLeaseExpired
+func (s *RedisSemaphore) Refresh() error {
+	// 不在持有锁的时候访问redis，避免阻塞Acquire和Release
+	s.mu.Lock()
+	tokens := make([]string, len(s.tokens))
+	copy(tokens, s.tokens)
+	s.mu.Unlock()
+
+	var err error
+	expired := make(map[string]bool)
+	for _, token := range tokens {
+		var ok bool
+		ok, err = refreshScript.Run(s.client, []string{s.key}, token, s.ttl.Milliseconds()).Bool()
+		if err != nil {
+			break
+		}
+
+		if !ok {
+			expired[token] = true
+		}
+	}
+
+	// 只丢弃确认已经过期的租约，发生错误之前的结果仍然有效
+	if len(expired) > 0 {
+		s.mu.Lock()
+		held := make([]string, 0, len(s.tokens))
+		for _, token := range s.tokens {
+			if !expired[token] {
+				held = append(held, token)
+			}
+		}
+
+		s.tokens = held
+		s.mu.Unlock()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(expired) > 0 {
+		return ErrLeaseExpired
+	}
+
+	return nil
+}
+
+// InUse 当前所有进程已经获取的资源数，包括还没有被清除的过期租约
+func (s *RedisSemaphore) InUse() (int64, error) {
+	return s.client.ZCard(s.key).Result()
+}
+
+// newToken 生成随机的租约token
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
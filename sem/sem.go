@@ -42,18 +42,36 @@ func (s *semaphore) Acquire() error {
 	select {
 	case s.sem <- struct{}{}:
 		return nil
-	case <-time.After(s.timeout):
+	default:
+	}
+
+	// stop the timer after acquire,so that it can be recycled immediately
+	t := time.NewTimer(s.timeout)
+	defer t.Stop()
+
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	case <-t.C:
 		return ErrNoTickets
 	}
 }
 
 // Release release sem
 func (s *semaphore) Release() error {
-	t := time.After(s.timeout)
 	select {
 	case <-s.sem:
 		return nil
-	case <-t: // release error
+	default:
+	}
+
+	t := time.NewTimer(s.timeout)
+	defer t.Stop()
+
+	select {
+	case <-s.sem:
+		return nil
+	case <-t.C: // release error
 		return ErrIllegalRelease
 	}
 }
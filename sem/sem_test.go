@@ -1,13 +1,240 @@
 package sem
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/go-redis/redis"
 )
 
+// TestWeighted test weighted semaphore
+func TestWeighted(t *testing.T) {
+	var s SemInterface = NewWeighted(10)
+	w := s.(*Weighted)
+	if err := w.AcquireN(context.Background(), 8); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.TryAcquire(3) || !w.TryAcquire(2) || w.Available() != 0 || w.InUse() != 10 {
+		t.Fatalf("available: %d in use: %d", w.Available(), w.InUse())
+	}
+
+	// 大的请求排在前面，后面的小请求不能插队
+	order := make(chan int64, 2)
+	go func() {
+		w.AcquireN(context.Background(), 6)
+		order <- 6
+	}()
+
+	for w.Waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() {
+		w.AcquireN(context.Background(), 1)
+		order <- 1
+	}()
+
+	for w.Waiting() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w.ReleaseN(5)
+	if w.TryAcquire(1) || w.Waiting() != 2 || w.InUse() != 5 {
+		t.Fatalf("small request should wait,waiting: %d in use: %d", w.Waiting(), w.InUse())
+	}
+
+	w.ReleaseN(1)
+	if n := <-order; n != 6 || w.Waiting() != 1 {
+		t.Fatalf("acquire order: %d", n)
+	}
+
+	w.ReleaseN(1)
+	if n := <-order; n != 1 {
+		t.Fatalf("acquire order: %d", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.AcquireN(ctx, 5); err != context.DeadlineExceeded || w.Waiting() != 0 {
+		t.Fatalf("acquire error: %v waiting: %d", err, w.Waiting())
+	}
+
+	if err := w.AcquireN(context.Background(), 11); err != ErrNoTickets {
+		t.Fatalf("acquire error: %v", err)
+	}
+
+	if err := w.ReleaseN(11); err != ErrIllegalRelease {
+		t.Fatalf("release error: %v", err)
+	}
+
+	w.ReleaseN(w.InUse())
+	if err := s.Acquire(); err != nil || w.InUse() != 1 {
+		t.Fatalf("acquire error: %v", err)
+	}
+
+	s.Release()
+}
+
+// TestWeightedInvalid test invalid weights
+func TestWeightedInvalid(t *testing.T) {
+	for _, v := range []struct {
+		name    string
+		acquire int64
+		release int64
+		err     error
+		inUse   int64
+	}{
+		{name: "acquire negative", acquire: -1, err: ErrInvalidWeight},
+		{name: "acquire zero", acquire: 0, err: nil},
+		{name: "acquire too large", acquire: 6, err: ErrNoTickets},
+		{name: "release negative", release: -3, err: ErrInvalidWeight, inUse: 2},
+		{name: "release zero", release: 0, err: nil, inUse: 2},
+		{name: "release too many", release: 3, err: ErrIllegalRelease, inUse: 2},
+	} {
+		s := NewWeighted(5)
+		var err error
+		if v.inUse > 0 {
+			s.AcquireN(context.Background(), v.inUse)
+			err = s.ReleaseN(v.release)
+		} else {
+			// 不能等待ctx结束，应当直接返回
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			start := time.Now()
+			err = s.AcquireN(ctx, v.acquire)
+			cancel()
+			if time.Since(start) > 100*time.Millisecond {
+				t.Fatalf("%s should return immediately", v.name)
+			}
+		}
+
+		if err != v.err || s.InUse() != v.inUse || s.Available() != 5-v.inUse {
+			t.Fatalf("%s error: %v in use: %d available: %d", v.name, err, s.InUse(), s.Available())
+		}
+	}
+
+	if NewWeighted(5).TryAcquire(-1) {
+		t.Fatal("try acquire negative weight should fail")
+	}
+}
+
+// TestRedisSemaphore test distributed semaphore
+func TestRedisSemaphore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+
+	if err := client.Ping().Err(); err != nil {
+		t.Skip("redis connection error: ", err)
+	}
+
+	key := "sem:test:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	defer client.Del(key)
+
+	s1 := NewRedis(client, key, 2, 50*time.Millisecond, WithLeaseTTL(200*time.Millisecond))
+	s2 := NewRedis(client, key, 2, 50*time.Millisecond, WithLeaseTTL(200*time.Millisecond))
+	if err := s1.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s2.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s2.Acquire(); err != ErrNoTickets {
+		t.Fatalf("acquire error: %v", err)
+	}
+
+	if err := s1.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s1.Release(); err != ErrIllegalRelease {
+		t.Fatalf("release error: %v", err)
+	}
+
+	// s2持有的租约过期后自动释放
+	if err := s1.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if err := s2.Refresh(); err != ErrLeaseExpired {
+		t.Fatalf("refresh error: %v", err)
+	}
+
+	if err := s1.Acquire(); err != nil {
+		t.Fatalf("acquire after expire error: %v", err)
+	}
+
+	// 有效期较短的实例不会缩短key的过期时间
+	s3 := NewRedis(client, key, 4, 50*time.Millisecond, WithLeaseTTL(5*time.Minute))
+	if err := s3.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	s4 := NewRedis(client, key, 4, 50*time.Millisecond, WithLeaseTTL(200*time.Millisecond))
+	if err := s4.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s4.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := client.PTTL(key).Val(); ttl < time.Minute {
+		t.Fatalf("key ttl shortened: %v", ttl)
+	}
+}
+
+// fakeRedis 模拟租约续期和释放的redis客户端
+type fakeRedis struct {
+	redis.Cmdable
+	refresh map[string]*redis.Cmd
+	removed []string
+}
+
+func (f *fakeRedis) EvalSha(sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return f.refresh[args[0].(string)]
+}
+
+func (f *fakeRedis) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	return f.EvalSha("", keys, args...)
+}
+
+func (f *fakeRedis) ZRem(key string, members ...interface{}) *redis.IntCmd {
+	f.removed = append(f.removed, members[0].(string))
+	return redis.NewIntResult(1, nil)
+}
+
+// TestRedisSemaphoreRefresh test refresh keeps held leases when redis fails
+func TestRedisSemaphoreRefresh(t *testing.T) {
+	errConn := errors.New("connection reset")
+	client := &fakeRedis{refresh: map[string]*redis.Cmd{
+		"a": redis.NewCmdResult(int64(0), nil),
+		"b": redis.NewCmdResult(int64(1), nil),
+		"c": redis.NewCmdResult(nil, errConn),
+	}}
+
+	s := NewRedis(client, "sem:refresh", 3, time.Second)
+	s.tokens = []string{"a", "b", "c"}
+	if err := s.Refresh(); err != errConn {
+		t.Fatalf("refresh error: %v", err)
+	}
+
+	for s.Release() == nil {
+	}
+
+	if len(client.removed) != 2 || client.removed[0] != "b" || client.removed[1] != "c" {
+		t.Fatalf("released leases: %v", client.removed)
+	}
+}
+
 func TestSemWithTimeout(t *testing.T) {
 	tickets, timeout := 1, 3*time.Second
 	s := New(tickets, timeout)
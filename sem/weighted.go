@@ -0,0 +1,177 @@
+package sem
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrInvalidWeight 获取或者释放的资源数小于0
+var ErrInvalidWeight = errors.New("semaphore: weight must not be negative")
+
+// waiter 等待获取信号量的请求
+type waiter struct {
+	n     int64
+	ready chan struct{} // 获取到信号量后关闭
+}
+
+// Weighted 带有权重的信号量，每次可以获取或者释放n个资源
+// 按照FIFO的顺序获取，排在前面的大请求不会被后面的小请求饿死
+type Weighted struct {
+	size    int64
+	cur     int64
+	mu      sync.Mutex
+	waiters list.List
+}
+
+// NewWeighted 创建带有权重的信号量，size为资源的总数
+func NewWeighted(size int64) *Weighted {
+	return &Weighted{size: size}
+}
+
+// Acquire 获取1个资源，实现SemInterface接口，会一直阻塞直到获取成功
+func (s *Weighted) Acquire() error {
+	return s.AcquireN(context.Background(), 1)
+}
+
+// Release 释放1个资源，实现SemInterface接口
+func (s *Weighted) Release() error {
+	return s.ReleaseN(1)
+}
+
+// AcquireN 获取n个资源，阻塞直到获取成功或者ctx被取消
+// 获取失败时返回ctx.Err()，n大于资源的总数时直接返回ErrNoTickets
+// n小于0时返回ErrInvalidWeight，n等于0时直接返回nil
+func (s *Weighted) AcquireN(ctx context.Context, n int64) error {
+	switch {
+	case n < 0:
+		return ErrInvalidWeight
+	case n == 0:
+		return nil
+	case n > s.size:
+		return ErrNoTickets
+	}
+
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(waiter{n: n, ready: ready})
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// 在取消的同时获取到了信号量，直接返回成功
+			s.mu.Unlock()
+			return nil
+		default:
+		}
+
+		isFront := s.waiters.Front() == elem
+		s.waiters.Remove(elem)
+
+		// 排在最前面的请求被取消后，后面的请求可能可以获取到信号量
+		if isFront && s.size > s.cur {
+			s.notifyWaiters()
+		}
+
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire 尝试获取n个资源，不会阻塞，获取成功返回true
+// 有其他请求在等待时返回false，保证FIFO的顺序
+func (s *Weighted) TryAcquire(n int64) bool {
+	if n < 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+
+	return false
+}
+
+// ReleaseN 释放n个资源，释放的数量超过已经获取的数量时返回ErrIllegalRelease
+// n小于0时返回ErrInvalidWeight
+func (s *Weighted) ReleaseN(n int64) error {
+	if n < 0 {
+		return ErrInvalidWeight
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n > s.cur {
+		return ErrIllegalRelease
+	}
+
+	s.cur -= n
+	s.notifyWaiters()
+	return nil
+}
+
+// Size 资源的总数
+func (s *Weighted) Size() int64 {
+	return s.size
+}
+
+// InUse 已经被获取的资源数
+func (s *Weighted) InUse() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cur
+}
+
+// Available 可以获取的资源数
+func (s *Weighted) Available() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size - s.cur
+}
+
+// Waiting 正在等待获取资源的请求个数
+func (s *Weighted) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.waiters.Len()
+}
+
+// notifyWaiters 按照FIFO的顺序唤醒可以获取到资源的请求
+// 排在最前面的请求资源不足时，后面的请求也不会被唤醒
+func (s *Weighted) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			break
+		}
+
+		w := next.Value.(waiter)
+		if s.size-s.cur < w.n {
+			break
+		}
+
+		s.cur += w.n
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
@@ -12,20 +12,54 @@
 package work
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/daheige/thinkgo/grecover"
+	"github.com/daheige/thinkgo/gtask"
 )
 
+// ErrShutdownTimeout 关闭工作池时，超过等待时间仍有worker没有执行完毕
+var ErrShutdownTimeout = errors.New("work pool shutdown timeout")
+
 // Worker worker必须满足Task方法
 type Worker interface {
 	Task()
 }
 
+// WorkerWithContext 支持上下文和错误返回的worker
+// 工作池ShutdownWithTimeout超时后，ctx会被取消
+type WorkerWithContext interface {
+	Task(ctx context.Context) error
+}
+
+// Unfinished 关闭工作池超时时仍在执行的worker
+type Unfinished struct {
+	Worker    interface{} // Worker或者WorkerWithContext
+	StartTime time.Time   // 开始执行的时间
+}
+
+// job 提交到工作池中的任务
+type job struct {
+	w      Worker
+	cw     WorkerWithContext
+	ctx    context.Context
+	cancel context.CancelFunc
+	start  time.Time
+}
+
 // Pool提供一个goroutine池,可以完成任何已提交的worker任务
 type Pool struct {
-	work chan Worker
-	wg   sync.WaitGroup
+	work       chan *job
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	running    map[*job]struct{}                    // 正在执行的任务
+	errHandler func(w WorkerWithContext, err error) // WorkerWithContext执行失败后的回调
 }
 
 // Logger log interface
@@ -38,7 +72,8 @@ var LogEntry Logger = log.New(os.Stderr, "", log.LstdFlags)
 // New 创建一个工作池
 func New(gNum int) *Pool {
 	p := &Pool{
-		work: make(chan Worker), // 无缓冲通道
+		work:    make(chan *job), // 无缓冲通道
+		running: make(map[*job]struct{}),
 	}
 
 	p.wg.Add(gNum) // 最大goroutine个数
@@ -50,8 +85,8 @@ func New(gNum int) *Pool {
 			defer p.wg.Done() // 执行完毕后计数信号量减去1
 
 			// for...range会一直阻塞,直到从work通道中收到一个Worker接口值
-			for w := range p.work {
-				w.Task() // 执行任务
+			for j := range p.work {
+				p.exec(j) // 执行任务
 			}
 		}(p)
 	}
@@ -63,7 +98,70 @@ func New(gNum int) *Pool {
 // 当任务提交后，消费者就会立即执行任务，p.wg计数器数量减去1
 // w是一个接口值,必须是具体实现类型的一个实例指针
 func (p *Pool) Add(w Worker) {
-	p.work <- w
+	p.work <- &job{w: w}
+}
+
+// AddContext 采用无缓冲通道提交WorkerWithContext到工作池
+// 所有的goroutine都在忙时会阻塞，ctx被取消后放弃提交并返回ctx.Err()
+// ctx会传递给w.Task，w.Task返回的错误通过SetErrorHandler设置的回调处理
+func (p *Pool) AddContext(ctx context.Context, w WorkerWithContext) error {
+	ctx, cancel := context.WithCancel(ctx)
+	select {
+	case p.work <- &job{cw: w, ctx: ctx, cancel: cancel}:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+// SetErrorHandler 设置WorkerWithContext执行失败后的回调函数，默认输出到LogEntry
+func (p *Pool) SetErrorHandler(fn func(w WorkerWithContext, err error)) {
+	p.errHandler = fn
+}
+
+// exec 执行单个任务，捕获任务中发生的panic
+func (p *Pool) exec(j *job) {
+	j.start = time.Now()
+	p.mu.Lock()
+	p.running[j] = struct{}{}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, j)
+		p.mu.Unlock()
+	}()
+
+	if j.w != nil {
+		defer catchRecover()
+
+		j.w.Task()
+		return
+	}
+
+	defer j.cancel()
+
+	err := func() (err error) {
+		defer func() {
+			if e := recover(); e != nil {
+				err = &gtask.PanicError{Value: e, Stack: grecover.CatchStack()}
+			}
+		}()
+
+		return j.cw.Task(j.ctx)
+	}()
+
+	if err == nil {
+		return
+	}
+
+	if p.errHandler != nil {
+		p.errHandler(j.cw, err)
+		return
+	}
+
+	LogEntry.Println("exec worker error: ", err)
 }
 
 // Shutdown 等待所有的goroutine执行完毕,它关闭了 work 通道
@@ -75,6 +173,49 @@ func (p *Pool) Shutdown() {
 	LogEntry.Println("all goroutine task finish")
 }
 
+// ShutdownWithTimeout 关闭工作池，最多等待timeout时间让正在执行的worker执行完毕
+// 超时后取消WorkerWithContext的ctx，返回仍在执行的worker和ErrShutdownTimeout
+func (p *Pool) ShutdownWithTimeout(timeout time.Duration) ([]Unfinished, error) {
+	close(p.work)
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		LogEntry.Println("all goroutine task finish")
+		return nil, nil
+	case <-timer.C:
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	unfinished := make([]Unfinished, 0, len(p.running))
+	for j := range p.running {
+		u := Unfinished{Worker: j.w, StartTime: j.start}
+		if j.cw != nil {
+			u.Worker = j.cw
+			j.cancel()
+		}
+
+		unfinished = append(unfinished, u)
+	}
+
+	sort.Slice(unfinished, func(i, j int) bool {
+		return unfinished[i].StartTime.Before(unfinished[j].StartTime)
+	})
+
+	LogEntry.Println("work pool shutdown timeout,unfinished worker count: ", len(unfinished))
+	return unfinished, ErrShutdownTimeout
+}
+
 // catchRecover 捕获异常或者panic处理
 func catchRecover() {
 	if err := recover(); err != nil {
@@ -1,10 +1,16 @@
 package work
 
 import (
+	"context"
+	"errors"
 	"log"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/daheige/thinkgo/gtask"
 )
 
 type myName struct {
@@ -78,3 +84,93 @@ func TestWorkPool(t *testing.T) {
 
 	p.Shutdown()
 }
+
+// ctxWorker 实现了WorkerWithContext接口
+type ctxWorker struct {
+	index int
+	block bool
+	panic bool
+}
+
+// Task 实现了WorkerWithContext接口
+func (w *ctxWorker) Task(ctx context.Context) error {
+	if w.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if w.panic {
+		panic("worker panic")
+	}
+
+	if w.index%2 == 1 {
+		return errors.New("odd index")
+	}
+
+	return nil
+}
+
+// TestWorkerWithContext test context worker and shutdown timeout
+func TestWorkerWithContext(t *testing.T) {
+	p := New(2)
+	var errCount int32
+	p.SetErrorHandler(func(w WorkerWithContext, err error) {
+		atomic.AddInt32(&errCount, 1)
+	})
+
+	for i := 0; i < 10; i++ {
+		if err := p.AddContext(context.Background(), &ctxWorker{index: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 所有的goroutine都在忙时，ctx取消后放弃提交
+	p.AddContext(context.Background(), &ctxWorker{block: true})
+	p.AddContext(context.Background(), &ctxWorker{block: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.AddContext(ctx, &ctxWorker{}); err != context.DeadlineExceeded {
+		t.Fatalf("add context error: %v", err)
+	}
+
+	unfinished, err := p.ShutdownWithTimeout(20 * time.Millisecond)
+	if err != ErrShutdownTimeout || len(unfinished) != 2 {
+		t.Fatalf("unfinished: %v error: %v", unfinished, err)
+	}
+
+	log.Println("unfinished worker: ", unfinished[0].Worker, unfinished[0].StartTime)
+	for _, u := range unfinished {
+		if w, ok := u.Worker.(*ctxWorker); !ok || !w.block {
+			t.Fatalf("unfinished worker: %v", u.Worker)
+		}
+	}
+
+	// 超时后ctx被取消，worker返回ctx.Err()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&errCount) != 7 {
+		if time.Now().After(deadline) {
+			t.Fatalf("error count: %d", atomic.LoadInt32(&errCount))
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// worker发生panic时，错误为带有堆栈信息的*gtask.PanicError
+	p = New(1)
+	panicErr := make(chan error, 1)
+	p.SetErrorHandler(func(w WorkerWithContext, err error) {
+		panicErr <- err
+	})
+
+	if err := p.AddContext(context.Background(), &ctxWorker{panic: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var pe *gtask.PanicError
+	if err := <-panicErr; !errors.As(err, &pe) || pe.Value != "worker panic" || len(pe.Stack) == 0 {
+		t.Fatalf("worker panic error: %v", err)
+	}
+
+	p.Shutdown()
+}
@@ -0,0 +1,138 @@
+package workpool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Future is the handle of a submitted task,
+// it can be used to wait for the task to finish and get the error of the task.
+type Future struct {
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{
+		done: make(chan struct{}),
+	}
+}
+
+// complete set the error of the task and close the done chan.
+func (f *Future) complete(err error) {
+	f.once.Do(func() {
+		f.err = err
+		close(f.done)
+	})
+}
+
+// Done returns a chan that is closed when the task is finished.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the task is finished and returns the error of the task.
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// Err returns the error of the task,
+// it returns nil when the task is not finished or exec success.
+func (f *Future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+// BatchFuture is the handle of a batch of submitted tasks.
+type BatchFuture struct {
+	futures []*Future
+}
+
+// Futures returns the future of each task,
+// in the same order as the submitted tasks.
+func (b *BatchFuture) Futures() []*Future {
+	return b.futures
+}
+
+// Wait blocks until all tasks are finished,
+// it returns a *BatchError when one or more tasks failed.
+func (b *BatchFuture) Wait() error {
+	errs := make(map[int]error)
+	for k, f := range b.futures {
+		if err := f.Wait(); err != nil {
+			errs[k] = err
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &BatchError{
+		Total:  len(b.futures),
+		Errors: errs,
+	}
+}
+
+// BatchError aggregated error report of a batch of tasks.
+type BatchError struct {
+	Total  int           // the total num of tasks
+	Errors map[int]error // the task index corresponding to the error
+}
+
+// Error implements error interface.
+func (e *BatchError) Error() string {
+	idx := make([]int, 0, len(e.Errors))
+	for k := range e.Errors {
+		idx = append(idx, k)
+	}
+
+	sort.Ints(idx)
+
+	msgs := make([]string, 0, len(idx))
+	for _, k := range idx {
+		msgs = append(msgs, fmt.Sprintf("task %d: %v", k, e.Errors[k]))
+	}
+
+	return fmt.Sprintf("%d of %d tasks failed: %s", len(e.Errors), e.Total, strings.Join(msgs, "; "))
+}
+
+// Submit add a task to the work pool and returns the future of the task.
+// If the work pool has been closed, the future returns ErrPoolClosed.
+func (p *Pool) Submit(t *Task) *Future {
+	f := newFuture()
+	if t == nil {
+		f.complete(nil)
+		return f
+	}
+
+	// copy the task so that the same task can be submitted many times.
+	st := *t
+	st.future = f
+	if err := p.addTask(&st, p.overflowPolicy); err != nil {
+		f.complete(err)
+	}
+
+	return f
+}
+
+// BatchSubmit batch add task to the work pool and returns the batch future.
+func (p *Pool) BatchSubmit(t []*Task) *BatchFuture {
+	b := &BatchFuture{
+		futures: make([]*Future, 0, len(t)),
+	}
+
+	for k := range t {
+		b.futures = append(b.futures, p.Submit(t[k]))
+	}
+
+	return b
+}
@@ -0,0 +1,383 @@
+package workpool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrHandlerNotFound the task handler is not registered by Register.
+var ErrHandlerNotFound = errors.New("task handler not found")
+
+// HandlerFunc the handler of the named task,
+// the payload is the serialized task data.
+type HandlerFunc func(ctx context.Context, payload []byte) error
+
+// Record the journal record of a named task.
+type Record struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// Journal persist the named tasks which are accepted by the work pool,
+// so that the tasks which are never completed can be replayed after restart.
+type Journal interface {
+	// Append record a task which is accepted by the work pool.
+	Append(rec *Record) error
+
+	// Ack mark the task as completed.
+	Ack(id string) error
+
+	// Pending returns the tasks which are accepted but never completed,
+	// in the order in which they are appended.
+	Pending() ([]*Record, error)
+}
+
+// WithJournal change the journal of the named tasks.
+// The pending tasks in the journal when the work pool is created
+// are replayed when the work pool runs,so the handlers must be registered before Run.
+func WithJournal(j Journal) Option {
+	return func(p *Pool) {
+		p.journal = j
+	}
+}
+
+// Register register the handler of the named task.
+func (p *Pool) Register(name string, h HandlerFunc) {
+	p.handlerMu.Lock()
+	defer p.handlerMu.Unlock()
+
+	if p.handlers == nil {
+		p.handlers = make(map[string]HandlerFunc)
+	}
+
+	p.handlers[name] = h
+}
+
+// NewNamedTask returns a serializable task whose handler is registered by Register.
+// When the work pool has a journal,the task is persisted until it is completed.
+func (p *Pool) NewNamedTask(name string, payload []byte, opts ...TaskOption) (*Task, error) {
+	p.handlerMu.RLock()
+	h, ok := p.handlers[name]
+	p.handlerMu.RUnlock()
+
+	if !ok {
+		return nil, ErrHandlerNotFound
+	}
+
+	t := NewTaskWithContext(context.Background(), func(ctx context.Context) error {
+		return h(ctx, payload)
+	}, opts...)
+	t.name = name
+	t.payload = payload
+	t.durable = true
+
+	return t, nil
+}
+
+// journalAppend persist the durable task before it is sent to the task queue,
+// it returns a copy of the task with the journal id.
+func (p *Pool) journalAppend(t *Task) (*Task, error) {
+	if p.journal == nil || !t.durable || t.journalID != "" {
+		return t, nil
+	}
+
+	jt := *t
+	jt.journalID = uuid.New().String()
+	err := p.journal.Append(&Record{
+		ID:      jt.journalID,
+		Name:    jt.name,
+		Payload: jt.payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &jt, nil
+}
+
+// journalAck mark the durable task as completed.
+func (p *Pool) journalAck(t *Task) {
+	if p.journal == nil || t.journalID == "" {
+		return
+	}
+
+	if err := p.journal.Ack(t.journalID); err != nil {
+		p.logEntry.Println("journal ack task error: ", err)
+	}
+}
+
+// loadPending load the pending tasks in the journal,
+// it must be called before any task is accepted by the work pool.
+func (p *Pool) loadPending() {
+	if p.journal == nil {
+		return
+	}
+
+	recs, err := p.journal.Pending()
+	if err != nil {
+		p.logEntry.Println("journal pending tasks error: ", err)
+		return
+	}
+
+	p.pending = recs
+}
+
+// replay add the pending tasks in the journal to the task queue.
+func (p *Pool) replay(recs []*Record) {
+	if len(recs) == 0 {
+		return
+	}
+
+	for _, rec := range recs {
+		t, err := p.NewNamedTask(rec.Name, rec.Payload)
+		if err != nil {
+			p.logEntry.Println("replay task: ", rec.Name, "error: ", err)
+			continue
+		}
+
+		t.journalID = rec.ID
+		if err := p.addTask(t, PolicyBlock); err != nil {
+			p.logEntry.Println("replay task: ", rec.Name, "error: ", err)
+			return
+		}
+	}
+
+	p.logEntry.Println("replay journal tasks count: ", len(recs))
+}
+
+// journalEntry a line of the journal file.
+type journalEntry struct {
+	Op string `json:"op"` // add or ack
+	Record
+}
+
+// DefaultCompactThreshold the default number of acked entries that triggers compaction.
+const DefaultCompactThreshold = 1000
+
+// FileJournal append-only journal on local disk,
+// each line of the file is a json encoded add or ack entry.
+type FileJournal struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	dead      int // acked entries since the last compaction
+	threshold int // compact the file when dead reaches threshold
+}
+
+// NewFileJournal returns a file journal,
+// the completed tasks are removed from the file when it is opened,
+// and again every DefaultCompactThreshold acks while it is in use.
+func NewFileJournal(path string) (*FileJournal, error) {
+	j := &FileJournal{
+		path:      path,
+		threshold: DefaultCompactThreshold,
+	}
+
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// SetCompactThreshold change the number of acked entries that triggers compaction,
+// zero or negative disables automatic compaction.
+func (j *FileJournal) SetCompactThreshold(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.threshold = n
+}
+
+// Compact rewrite the journal file with the pending tasks only.
+func (j *FileJournal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.reopen()
+}
+
+// open open the journal file for appending.
+func (j *FileJournal) open() error {
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	j.file = file
+	return nil
+}
+
+// reopen compact the journal file and open it again,the caller must hold j.mu.
+func (j *FileJournal) reopen() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+
+	err := j.compact()
+	if oErr := j.open(); err == nil {
+		err = oErr
+	}
+
+	if err == nil {
+		j.dead = 0
+	}
+
+	return err
+}
+
+// Append implements Journal interface.
+func (j *FileJournal) Append(rec *Record) error {
+	return j.write(&journalEntry{Op: "add", Record: *rec}, true)
+}
+
+// Ack implements Journal interface.
+func (j *FileJournal) Ack(id string) error {
+	return j.write(&journalEntry{Op: "ack", Record: Record{ID: id}}, false)
+}
+
+// Pending implements Journal interface.
+func (j *FileJournal) Pending() ([]*Record, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return readJournal(j.path)
+}
+
+// Close close the journal file.
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+func (j *FileJournal) write(entry *journalEntry, sync bool) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err = j.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	// the accepted task must be persisted,
+	// the lost ack only leads to the task being executed again.
+	if sync {
+		return j.file.Sync()
+	}
+
+	j.dead++
+	if j.threshold > 0 && j.dead >= j.threshold {
+		return j.reopen()
+	}
+
+	return nil
+}
+
+// compact rewrite the journal file with the pending tasks.
+func (j *FileJournal) compact() error {
+	recs, err := readJournal(j.path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.Create(filepath.Join(filepath.Dir(j.path), "."+filepath.Base(j.path)+".tmp"))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, rec := range recs {
+		if err = enc.Encode(&journalEntry{Op: "add", Record: *rec}); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// readJournal returns the pending tasks in the journal file.
+func readJournal(path string) ([]*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer file.Close()
+
+	recs := make([]*Record, 0, 16)
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		entry := &journalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			// skip the broken line,eg: the process crashed when writing.
+			continue
+		}
+
+		switch entry.Op {
+		case "add":
+			index[entry.ID] = len(recs)
+			rec := entry.Record
+			recs = append(recs, &rec)
+		case "ack":
+			if k, ok := index[entry.ID]; ok {
+				recs[k] = nil
+				delete(index, entry.ID)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	pending := make([]*Record, 0, len(index))
+	for _, rec := range recs {
+		if rec != nil {
+			pending = append(pending, rec)
+		}
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,121 @@
+package workpool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter token bucket rate limiter,it is shared by all workers.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64 // max tokens in the bucket
+	tokens float64 // current tokens,negative means reserved by waiting workers
+	last   time.Time
+}
+
+// newLimiter returns a token bucket limiter with full bucket.
+func newLimiter(rate float64, burst int) *limiter {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve take a token and returns the wait time until the token is available.
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel give back the reserved token.
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// wait blocks until a token is available or the ctx is done.
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+
+	d := l.reserve()
+	if d <= 0 {
+		return nil
+	}
+
+	if !sleepContext(ctx, d) {
+		l.cancel()
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// WithRateLimit limit the task exec rate of all workers by token bucket,
+// rate is the tasks per second,burst is the max tasks executed at once.
+// Each retry of the task also takes a token.
+// It disables the default exec interval of each worker.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(p *Pool) {
+		p.limiter = newLimiter(rate, burst)
+		p.execInterval = 0
+	}
+}
+
+// WithQueueRateLimit limit the task exec rate of the named queue by token bucket,
+// it works together with WithRateLimit.
+func WithQueueRateLimit(name string, rate float64, burst int) Option {
+	return func(p *Pool) {
+		if p.queueLimiters == nil {
+			p.queueLimiters = make(map[string]*limiter)
+		}
+
+		p.queueLimiters[name] = newLimiter(rate, burst)
+	}
+}
+
+// rateWait blocks until the task can be executed by the rate limit.
+// The queue limiter is waited first,
+// so that a task of a slow queue does not hold the global budget while waiting.
+func (p *Pool) rateWait(ctx context.Context, t *Task) error {
+	if len(p.queueLimiters) > 0 {
+		name := t.queue
+		if name == "" {
+			name = DefaultQueue
+		}
+
+		if err := p.queueLimiters[name].wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return p.limiter.wait(ctx)
+}
@@ -0,0 +1,150 @@
+package workpool
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolStats task counters of the work pool.
+type poolStats struct {
+	queued    int64  // tasks in the task queue
+	running   int64  // tasks being executed
+	completed uint64 // tasks finished without error
+	failed    uint64 // tasks finished with error
+	panicked  uint64 // panics when exec task,include retries
+}
+
+// Stats the snapshot of the work pool status.
+type Stats struct {
+	Name      string // work pool name
+	Workers   int    // current worker num
+	Queued    int64  // tasks in the task queue
+	Running   int64  // tasks being executed
+	Completed uint64 // tasks finished without error
+	Failed    uint64 // tasks finished with error
+	Panicked  uint64 // panics when exec task,include retries
+}
+
+// Name returns the work pool name.
+func (p *Pool) Name() string {
+	return p.name
+}
+
+// Stats returns the snapshot of the work pool status.
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Name:      p.name,
+		Workers:   p.WorkerCount(),
+		Queued:    atomic.LoadInt64(&p.stats.queued),
+		Running:   atomic.LoadInt64(&p.stats.running),
+		Completed: atomic.LoadUint64(&p.stats.completed),
+		Failed:    atomic.LoadUint64(&p.stats.failed),
+		Panicked:  atomic.LoadUint64(&p.stats.panicked),
+	}
+}
+
+// observe record the result of a finished task,d is the exec duration of its last attempt.
+func (p *Pool) observe(d time.Duration, err error) {
+	if err != nil {
+		atomic.AddUint64(&p.stats.failed, 1)
+	} else {
+		atomic.AddUint64(&p.stats.completed, 1)
+	}
+
+	p.observerMu.RLock()
+	defer p.observerMu.RUnlock()
+
+	for _, fn := range p.observers {
+		fn(d, err)
+	}
+}
+
+// addObserver add a func called after each task is finished.
+func (p *Pool) addObserver(fn func(d time.Duration, err error)) {
+	p.observerMu.Lock()
+	defer p.observerMu.Unlock()
+
+	p.observers = append(p.observers, fn)
+}
+
+// Collector prometheus collector for work pool,
+// the metrics are labelled by the work pool name.
+//
+// usage:
+//
+//	prometheus.MustRegister(workpool.NewCollector(p))
+type Collector struct {
+	pools     []*Pool
+	queued    *prometheus.Desc
+	running   *prometheus.Desc
+	workers   *prometheus.Desc
+	completed *prometheus.Desc
+	failed    *prometheus.Desc
+	panicked  *prometheus.Desc
+	duration  *prometheus.HistogramVec
+}
+
+// NewCollector returns a prometheus collector for the work pools.
+func NewCollector(pools ...*Pool) *Collector {
+	labels := []string{"pool"}
+	c := &Collector{
+		pools: pools,
+		queued: prometheus.NewDesc("workpool_tasks_queued",
+			"Number of tasks in the task queue", labels, nil),
+		running: prometheus.NewDesc("workpool_tasks_running",
+			"Number of tasks being executed", labels, nil),
+		workers: prometheus.NewDesc("workpool_workers",
+			"Number of current workers", labels, nil),
+		completed: prometheus.NewDesc("workpool_tasks_completed_total",
+			"Number of tasks finished without error", labels, nil),
+		failed: prometheus.NewDesc("workpool_tasks_failed_total",
+			"Number of tasks finished with error", labels, nil),
+		panicked: prometheus.NewDesc("workpool_tasks_panicked_total",
+			"Number of panics when exec task", labels, nil),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "workpool_task_duration_seconds",
+				Help:    "task exec duration distribution",
+				Buckets: prometheus.DefBuckets,
+			},
+			labels,
+		),
+	}
+
+	for _, p := range pools {
+		observer := c.duration.WithLabelValues(p.name)
+		p.addObserver(func(d time.Duration, err error) {
+			observer.Observe(d.Seconds())
+		})
+	}
+
+	return c
+}
+
+// Describe implements prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queued
+	ch <- c.running
+	ch <- c.workers
+	ch <- c.completed
+	ch <- c.failed
+	ch <- c.panicked
+	c.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.pools {
+		s := p.Stats()
+		ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(s.Queued), s.Name)
+		ch <- prometheus.MustNewConstMetric(c.running, prometheus.GaugeValue, float64(s.Running), s.Name)
+		ch <- prometheus.MustNewConstMetric(c.workers, prometheus.GaugeValue, float64(s.Workers), s.Name)
+		ch <- prometheus.MustNewConstMetric(c.completed, prometheus.CounterValue, float64(s.Completed), s.Name)
+		ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(s.Failed), s.Name)
+		ch <- prometheus.MustNewConstMetric(c.panicked, prometheus.CounterValue, float64(s.Panicked), s.Name)
+	}
+
+	c.duration.Collect(ch)
+}
@@ -0,0 +1,151 @@
+package workpool
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrPoolFull the task queue is full and the task is rejected.
+	ErrPoolFull = errors.New("work pool is full")
+
+	// ErrTaskDropped the task is dropped by PolicyDropOldest.
+	ErrTaskDropped = errors.New("task is dropped")
+)
+
+// OverflowPolicy the policy when the task queue is full.
+type OverflowPolicy int
+
+const (
+	// PolicyBlock block until the task queue has space,
+	// returns ErrPoolFull after the block timeout when WithBlockTimeout is set.
+	PolicyBlock OverflowPolicy = iota
+
+	// PolicyReject reject the task with ErrPoolFull.
+	PolicyReject
+
+	// PolicyDropOldest drop the oldest task in the task queue to make room,
+	// the future of the dropped task returns ErrTaskDropped.
+	PolicyDropOldest
+
+	// PolicyCallerRuns exec the task in the caller goroutine.
+	PolicyCallerRuns
+)
+
+// String returns the policy name.
+func (o OverflowPolicy) String() string {
+	switch o {
+	case PolicyBlock:
+		return "block"
+	case PolicyReject:
+		return "reject"
+	case PolicyDropOldest:
+		return "drop_oldest"
+	case PolicyCallerRuns:
+		return "caller_runs"
+	default:
+		return "unknown"
+	}
+}
+
+// WithOverflowPolicy change the policy when the task queue is full,default PolicyBlock.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(p *Pool) {
+		p.overflowPolicy = policy
+	}
+}
+
+// WithBlockTimeout change the max block time of PolicyBlock,
+// zero means block until the task queue has space or the work pool is closed.
+func WithBlockTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.blockTimeout = d
+	}
+}
+
+// enqueue send a task to the queue chan according to the overflow policy.
+func (p *Pool) enqueue(q *queue, t *Task, policy OverflowPolicy) (err error) {
+	// count the task as queued before sending,so that the queued num is never negative.
+	atomic.AddInt64(&p.stats.queued, 1)
+	queued := false
+	defer func() {
+		if !queued {
+			atomic.AddInt64(&p.stats.queued, -1)
+		}
+	}()
+
+	select {
+	case <-p.stop:
+		return ErrPoolClosed
+	default:
+	}
+
+	select {
+	case q.ch <- t:
+		queued = true
+		return nil
+	default:
+	}
+
+	// the task queue is full.
+	switch policy {
+	case PolicyReject:
+		return ErrPoolFull
+	case PolicyDropOldest:
+		for i := 0; i < 3; i++ {
+			select {
+			case old, ok := <-q.ch:
+				if !ok {
+					return ErrPoolClosed
+				}
+
+				p.logEntry.Println("task queue is full,drop the oldest task")
+				atomic.AddInt64(&p.stats.queued, -1)
+				p.journalAck(old)
+				if old.future != nil {
+					old.future.complete(ErrTaskDropped)
+				}
+			default:
+			}
+
+			select {
+			case <-p.stop:
+				return ErrPoolClosed
+			case q.ch <- t:
+				queued = true
+				return nil
+			default:
+			}
+		}
+
+		return ErrPoolFull
+	case PolicyCallerRuns:
+		select {
+		case <-p.stop:
+			return ErrPoolClosed
+		default:
+		}
+
+		p.runTask(t)
+		return nil
+	default:
+		var timeout <-chan time.Time
+		if p.blockTimeout > 0 {
+			timer := time.NewTimer(p.blockTimeout)
+			defer timer.Stop()
+
+			timeout = timer.C
+		}
+
+		select {
+		case <-p.stop:
+			return ErrPoolClosed
+		case q.ch <- t:
+			queued = true
+			return nil
+		case <-timeout:
+			return ErrPoolFull
+		}
+	}
+}
@@ -3,42 +3,15 @@ package workpool
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/signal"
-	"syscall"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Task task struct.
-type Task struct {
-	fn func() error
-}
-
-// NewTask returns task,create a task entry.
-func NewTask(fn func() error) *Task {
-	return &Task{
-		fn: fn,
-	}
-}
-
-// run exec a task.
-func (t *Task) run(logEntry Logger) {
-	if t == nil {
-		return
-	}
-
-	defer func() {
-		if e := recover(); e != nil {
-			logEntry.Println("exec current task panic: ", e)
-		}
-	}()
-
-	err := t.fn()
-	if err != nil {
-		logEntry.Println("exec task error: ", err)
-	}
-}
-
 // Logger log record interface
 type Logger interface {
 	Println(args ...interface{})
@@ -49,19 +22,53 @@ type Pool struct {
 	// execInterval interval time after each task is executed
 	// interval default 10ms
 	execInterval   time.Duration
-	entryChan      chan *Task     // task entry chan
+	entryChan      chan *Task     // task entry chan of the default queue
+	queueWeights   map[string]int // the weight of each named queue
+	overflowPolicy OverflowPolicy // the policy when the task queue is full
+	blockTimeout   time.Duration  // max block time of PolicyBlock,zero means no timeout
+	scheduler      *scheduler     // pick task from queues by weight
 	entryCap       int            // entry chan num
 	jobChan        chan *Task     // job chan
 	jobCap         int            // job chan num
-	workerCap      int            // worker chan num
+	workerCap      int            // worker chan num,it is also the min worker num
+	maxWorkers     int            // max worker num,default equal to workerCap
+	workerIdle     time.Duration  // idle time after which the extra worker exits,default 60s
+	workerNum      int32          // current worker num
+	workerSeq      int32          // worker id sequence
+	workerWait     sync.WaitGroup // wait for all workers to exit
 	logEntry       Logger         // logger interface
-	stop           chan struct{}  // stop sem
-	interrupt      chan os.Signal // interrupt signal
+	stop           chan struct{}  // stop sem,closed when the work pool begins to shutdown
+	stopReq        chan struct{}  // closed when Stop is called
+	stopOnce       sync.Once
+	done           chan struct{}  // closed when Run returns
+	running        int32          // whether Run has been called
+	signals        []os.Signal    // the signals to shutdown the work pool,default none
 	entryCloseWait time.Duration  // close entry chan wait time,default 5s
 	shutdownWait   time.Duration  // work pool shutdown wait time,default 3s
+	taskTimeout    time.Duration  // default exec timeout of each task,zero means no timeout
+	retryPolicy    *RetryPolicy   // default retry policy of each task
+	deadLetter     DeadLetterFunc // handle the task which fails finally
+	name           string         // work pool name,default workpool
+	stats          poolStats      // task counters of the work pool
+	observerMu     sync.RWMutex
+	observers      []func(d time.Duration, err error) // called after each task is finished
+	journal        Journal                            // persist the named tasks
+	pending        []*Record                          // the pending tasks to be replayed
+	limiter        *limiter                           // task exec rate limiter of all workers
+	queueLimiters  map[string]*limiter                // task exec rate limiter of each queue
+	handlerMu      sync.RWMutex
+	handlers       map[string]HandlerFunc // the handlers of the named tasks
+
+	// ctx is the root context of all tasks,
+	// it will be cancelled when the work pool is shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 var (
+	// ErrPoolClosed the work pool has been closed and does not accept task.
+	ErrPoolClosed = errors.New("work pool is closed")
+
 	// defaultMaxEntryCap default max entry chan num.
 	defaultMaxEntryCap = 10000
 
@@ -75,9 +82,6 @@ var (
 	// defaultMinWorker default min worker.
 	defaultMinWorker = 3
 
-	// empty struct
-	est = struct{}{}
-
 	// dummy logger writes nothing.
 	dummyLogger = LoggerFunc(func(...interface{}) {})
 )
@@ -92,6 +96,7 @@ func (f LoggerFunc) Println(args ...interface{}) { f(args...) }
 type Option func(p *Pool)
 
 // WithExecInterval interval time after each task is executed.
+// It sleeps in each worker,use WithRateLimit for precise throttling.
 func WithExecInterval(t time.Duration) Option {
 	return func(p *Pool) {
 		p.execInterval = t
@@ -105,6 +110,22 @@ func WithEntryCap(n int) Option {
 	}
 }
 
+// WithQueue register a named task queue with weight.
+// Each queue has its own entry chan with entryCap,
+// tasks are picked from queues by smooth weighted round-robin,
+// the higher weight queue gets more chances to be executed.
+// The weight of the default queue is 1,it can be changed by WithQueue(DefaultQueue, weight).
+// For better priority,the job chan cap should be small.
+func WithQueue(name string, weight int) Option {
+	return func(p *Pool) {
+		if p.queueWeights == nil {
+			p.queueWeights = make(map[string]int)
+		}
+
+		p.queueWeights[name] = weight
+	}
+}
+
 // WithJobCap job chan number.
 func WithJobCap(n int) Option {
 	return func(p *Pool) {
@@ -119,6 +140,47 @@ func WithWorkerCap(num int) Option {
 	}
 }
 
+// WithMinWorkers change min worker num,it is same as WithWorkerCap.
+// The min workers are created when the work pool runs and never exit
+// until the work pool is shutdown.
+func WithMinWorkers(num int) Option {
+	return func(p *Pool) {
+		p.workerCap = num
+	}
+}
+
+// WithMaxWorkers change max worker num.
+// When the job chan backlog grows, the work pool spawns extra workers
+// up to the max worker num.
+func WithMaxWorkers(num int) Option {
+	return func(p *Pool) {
+		p.maxWorkers = num
+	}
+}
+
+// WithWorkerIdleTimeout change the idle time after which the extra worker exits.
+func WithWorkerIdleTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.workerIdle = d
+	}
+}
+
+// WithName change the work pool name,it is used as the metrics label.
+func WithName(name string) Option {
+	return func(p *Pool) {
+		p.name = name
+	}
+}
+
+// WithSignals listen the signals to shutdown the work pool gracefully.
+// By default the work pool does not handle any signal,
+// eg: WithSignals(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+func WithSignals(sigs ...os.Signal) Option {
+	return func(p *Pool) {
+		p.signals = sigs
+	}
+}
+
 // WithLogger change logger entry.
 func WithLogger(logEntry Logger) Option {
 	return func(p *Pool) {
@@ -140,6 +202,14 @@ func WithShutdownWait(d time.Duration) Option {
 	}
 }
 
+// WithDefaultTaskTimeout change the default exec timeout of each task.
+// It can be overridden by WithTaskTimeout for a single task.
+func WithDefaultTaskTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.taskTimeout = d
+	}
+}
+
 // NewPool returns a pool.
 func NewPool(opts ...Option) *Pool {
 	p := &Pool{
@@ -148,17 +218,34 @@ func NewPool(opts ...Option) *Pool {
 		stop:           make(chan struct{}, 1),
 		entryCloseWait: 5 * time.Second,
 		shutdownWait:   3 * time.Second,
-		interrupt:      make(chan os.Signal, 1),
+		workerIdle:     60 * time.Second,
+		name:           "workpool",
+		stopReq:        make(chan struct{}),
+		done:           make(chan struct{}),
 		logEntry:       dummyLogger, // default logger entry.
 	}
 
 	// option functions.
 	p.apply(opts...)
 
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
 	if p.workerCap >= defaultMaxWorker {
 		p.workerCap = defaultMaxWorker
 	}
 
+	if p.workerCap <= 0 {
+		p.workerCap = 1
+	}
+
+	if p.maxWorkers >= defaultMaxWorker {
+		p.maxWorkers = defaultMaxWorker
+	}
+
+	if p.maxWorkers < p.workerCap {
+		p.maxWorkers = p.workerCap
+	}
+
 	if p.jobCap == 0 {
 		// no buf for jobChan.
 		p.jobChan = make(chan *Task)
@@ -181,6 +268,22 @@ func NewPool(opts ...Option) *Pool {
 		p.entryChan = make(chan *Task, p.entryCap)
 	}
 
+	p.loadPending()
+
+	p.scheduler = newScheduler()
+	p.scheduler.add(DefaultQueue, p.queueWeights[DefaultQueue], p.entryChan)
+	names := make([]string, 0, len(p.queueWeights))
+	for name := range p.queueWeights {
+		if name != DefaultQueue {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		p.scheduler.add(name, p.queueWeights[name], make(chan *Task, p.entryCap))
+	}
+
 	return p
 }
 
@@ -190,70 +293,296 @@ func (p *Pool) apply(opts ...Option) {
 	}
 }
 
-// AddTask add a task to p.entryChan.
-func (p *Pool) AddTask(t *Task) {
+// AddTask add a task to the task queue.
+// When the task queue is full,the task is handled by the overflow policy.
+// It returns ErrPoolClosed when the work pool has been closed,
+// and ErrPoolFull when the task is rejected.
+func (p *Pool) AddTask(t *Task) error {
 	if t == nil {
-		return
+		return nil
 	}
 
-	defer p.recovery()
+	return p.addTask(t, p.overflowPolicy)
+}
 
-	select {
-	case <-p.stop:
-		return
-	default:
-		p.entryChan <- t
+// TryAddTask add a task to the task queue without blocking,
+// it returns ErrPoolFull when the task queue is full.
+func (p *Pool) TryAddTask(t *Task) error {
+	if t == nil {
+		return nil
 	}
-}
 
-// BatchAddTask batch add task to p.entryChan.
-func (p *Pool) BatchAddTask(t []*Task) {
-	defer p.recovery()
+	return p.addTask(t, PolicyReject)
+}
 
+// BatchAddTask batch add task to the task queue,
+// it stops and returns the error when a task can not be added.
+func (p *Pool) BatchAddTask(t []*Task) error {
 	for k := range t {
 		if t[k] == nil {
 			continue
 		}
 
-		select {
-		case <-p.stop:
-			return
-		default:
-			p.entryChan <- t[k]
+		if err := p.addTask(t[k], p.overflowPolicy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addTask send a task to the entry chan of the task queue,
+// returns ErrPoolClosed when the work pool has been closed.
+func (p *Pool) addTask(t *Task, policy OverflowPolicy) (err error) {
+	q, err := p.scheduler.get(t.queue)
+	if err != nil {
+		return err
+	}
+
+	t, err = p.journalAppend(t)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// the task is not accepted by the work pool.
+		if err != nil {
+			p.journalAck(t)
+		}
+	}()
+
+	defer func() {
+		// send on closed entry chan.
+		if e := recover(); e != nil {
+			err = ErrPoolClosed
+		}
+
+		if err != nil {
+			p.logEntry.Println("add task error: ", err)
+		}
+	}()
+
+	return p.enqueue(q, t, policy)
+}
+
+// runTask exec a task in current goroutine,
+// the failed task will be retried by the retry policy,
+// and sent to the dead letter handler when it fails finally.
+func (p *Pool) runTask(t *Task) {
+	if t == nil {
+		return
+	}
+
+	// copy the task so that the same task can be added many times.
+	rt := *t
+	t = &rt
+
+	ctx, cancel := t.context(p.ctx)
+	defer cancel()
+
+	atomic.AddInt64(&p.stats.running, 1)
+	defer atomic.AddInt64(&p.stats.running, -1)
+
+	timeout := p.taskTimeout
+	if t.timeout > 0 {
+		timeout = t.timeout
+	}
+
+	policy := t.retry
+	if policy == nil {
+		policy = p.retryPolicy
+	}
+
+	var (
+		err  error
+		cost time.Duration // exec duration of the last attempt,without rate limit and backoff waits
+	)
+
+	for {
+		t.attempts++
+
+		// the task has been cancelled before exec,eg: the work pool is shutdown.
+		if err = ctx.Err(); err != nil {
+			p.logEntry.Println("current task has been cancelled: ", err)
+			break
+		}
+
+		if err = p.rateWait(ctx, t); err != nil {
+			p.logEntry.Println("current task has been cancelled: ", err)
+			break
+		}
+
+		start := time.Now()
+		err = t.run(ctx, timeout, p.logEntry)
+		cost = time.Since(start)
+		if errors.Is(err, ErrTaskPanic) {
+			atomic.AddUint64(&p.stats.panicked, 1)
+		}
+
+		if err == nil || !policy.retryable(err, t.attempts) {
+			break
+		}
+
+		d := policy.backoff(t.attempts)
+		p.logEntry.Println("task will retry after: ", d, "attempts: ", t.attempts)
+		if !sleepContext(ctx, d) {
+			break
+		}
+	}
+
+	p.observe(cost, err)
+
+	if err != nil && p.deadLetter != nil {
+		p.deadLetter(t, err)
+	}
+
+	// the task interrupted by shutdown is kept in the journal to be replayed.
+	if err == nil || p.ctx.Err() == nil {
+		p.journalAck(t)
+	}
+
+	if t.future != nil {
+		t.future.complete(err)
+	}
+}
+
+// WorkerCount returns the current worker num.
+func (p *Pool) WorkerCount() int {
+	return int(atomic.LoadInt32(&p.workerNum))
+}
+
+// spawn create a worker goroutine if the worker num is less than max.
+func (p *Pool) spawn(max int) bool {
+	for {
+		num := atomic.LoadInt32(&p.workerNum)
+		if int(num) >= max {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&p.workerNum, num, num+1) {
+			break
+		}
+	}
+
+	p.workerWait.Add(1)
+	go p.exec(int(atomic.AddInt32(&p.workerSeq, 1)))
+
+	return true
+}
+
+// retire decrease the worker num if the worker num is greater than min.
+func (p *Pool) retire() bool {
+	for {
+		num := atomic.LoadInt32(&p.workerNum)
+		if int(num) <= p.workerCap {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&p.workerNum, num, num-1) {
+			return true
 		}
 	}
 }
 
 // exec exec task from job chan.
-func (p *Pool) exec(id int, done chan struct{}) {
+func (p *Pool) exec(id int) {
 	defer p.recovery()
 
+	retired := false
 	defer func() {
-		done <- est
+		if !retired {
+			atomic.AddInt32(&p.workerNum, -1)
+		}
+
+		p.workerWait.Done()
 		p.logEntry.Println("current worker id: ", id, "will exit...")
 	}()
 
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if p.maxWorkers > p.workerCap && p.workerIdle > 0 {
+		timer = time.NewTimer(p.workerIdle)
+		defer timer.Stop()
+
+		idle = timer.C
+	}
+
 	// get task from JobChan to run.
-	for task := range p.jobChan {
-		task.run(p.logEntry)
-		p.logEntry.Println("current worker id: ", id)
+	for {
+		select {
+		case task, ok := <-p.jobChan:
+			if !ok {
+				return
+			}
+
+			atomic.AddInt64(&p.stats.queued, -1)
+			p.runTask(task)
+			p.logEntry.Println("current worker id: ", id)
+
+			// interval time after each task is executed.
+			if p.execInterval > 0 {
+				time.Sleep(p.execInterval)
+			}
+
+			if timer != nil {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+
+				timer.Reset(p.workerIdle)
+			}
+		case <-idle:
+			// the extra worker exits after idle timeout.
+			if p.retire() {
+				retired = true
+				return
+			}
+
+			timer.Reset(p.workerIdle)
+		}
+	}
+}
 
-		// interval time after each task is executed.
-		if p.execInterval > 0 {
-			time.Sleep(p.execInterval)
+// dispatch throw a task to job chan,
+// it spawns an extra worker when the job chan backlog grows.
+func (p *Pool) dispatch(task *Task) {
+	if p.maxWorkers <= p.workerCap {
+		p.jobChan <- task
+		return
+	}
+
+	select {
+	case p.jobChan <- task:
+		if len(p.jobChan) > 0 {
+			p.spawn(p.maxWorkers)
 		}
+	default:
+		// all workers are busy and the job chan is full.
+		p.spawn(p.maxWorkers)
+		p.jobChan <- task
 	}
 }
 
 // Run create workerCap goroutine to exec task.
-func (p *Pool) Run() {
+// It blocks until the work pool is shutdown and all workers exit.
+// The work pool begins to shutdown when the ctx is done,
+// Stop is called or the signals of WithSignals are received.
+func (p *Pool) Run(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+		p.logEntry.Println("work pool is already running or stopped")
+		return
+	}
+
+	defer close(p.done)
+
 	p.logEntry.Println("exec task begin...")
-	signal.Notify(p.interrupt, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
 
-	doneBuf := make(chan struct{}, p.workerCap)
 	// create p.workerCap goroutine to do task
 	for i := 0; i < p.workerCap; i++ {
-		go p.exec(i+1, doneBuf)
+		p.spawn(p.workerCap)
 	}
 
 	// throw entry chan task to JobChan
@@ -261,37 +590,137 @@ func (p *Pool) Run() {
 		defer close(p.jobChan)
 
 		// If the entry channel is closed, the block will be lifted until consumption is completed.
-		for task := range p.entryChan {
-			p.jobChan <- task
+		for {
+			task, ok := p.scheduler.next()
+			if !ok {
+				return
+			}
+
+			p.dispatch(task)
 		}
 	}()
 
-	// listen interrupt signal for work pool graceful exit.
-	go func() {
-		// Block until we receive stop signal.
-		sig := <-p.interrupt
+	// listen stop event for work pool graceful exit.
+	go p.watch(ctx)
+
+	// replay the pending tasks in the journal.
+	recs := p.pending
+	p.pending = nil
+	go p.replay(recs)
+
+	// entryCloseWait all job chan task to finish.
+	p.workerWait.Wait()
+
+	p.cancel()
+
+	p.logEntry.Println("work pool shutdown success")
+}
+
+// watch wait for the stop event and shutdown the work pool gracefully.
+func (p *Pool) watch(ctx context.Context) {
+	var interrupt chan os.Signal
+	if len(p.signals) > 0 {
+		interrupt = make(chan os.Signal, 1)
+		signal.Notify(interrupt, p.signals...)
+		defer signal.Stop(interrupt)
+	}
+
+	// Block until we receive stop event.
+	select {
+	case sig := <-interrupt:
 		p.logEntry.Println("recv signal: ", sig.String())
-		close(p.stop)
+	case <-ctx.Done():
+		p.logEntry.Println("run context done: ", ctx.Err())
+	case <-p.stopReq:
+		p.logEntry.Println("recv stop request")
+	case <-p.ctx.Done():
+	}
+
+	close(p.stop)
 
-		// Here you need to entryCloseWait for the task that has been sent to the entry chan
-		// to ensure that it can be sent successfully
-		ctx, cancel := context.WithTimeout(context.Background(), p.entryCloseWait)
-		defer cancel()
+	// Here you need to entryCloseWait for the task that has been sent to the entry chan
+	// to ensure that it can be sent successfully
+	timer := time.NewTimer(p.entryCloseWait)
+	select {
+	case <-timer.C:
+	case <-p.ctx.Done():
+		timer.Stop()
+	}
 
-		<-ctx.Done()
+	p.scheduler.close()
 
-		close(p.entryChan)
-	}()
+	// give the remaining tasks shutdownWait time to finish,
+	// then cancel the root context so that long-running tasks can stop.
+	timer = time.NewTimer(p.shutdownWait)
+	defer timer.Stop()
 
-	// entryCloseWait all job chan task to finish.
-	for i := 0; i < p.workerCap; i++ {
-		<-doneBuf
+	select {
+	case <-timer.C:
+		p.logEntry.Println("shutdown wait timeout,cancel all running tasks")
+		p.cancel()
+	case <-p.ctx.Done():
 	}
+}
 
-	p.logEntry.Println("work pool shutdown success")
+// Stop shutdown the work pool gracefully and wait for Run to return.
+// If the ctx is done before all workers exit,
+// the running tasks are cancelled and it returns the ctx error.
+//
+// If Run has not been called, Stop does not wait for it.
+// It waits at most entryCloseWait for the concurrent AddTask calls,
+// then the queued tasks are discarded and their futures complete with ErrPoolClosed.
+// After that the pool rejects new tasks and the later Run returns right away.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stopReq)
+	})
+
+	p.logEntry.Println("work pool will shutdown...")
+
+	// mark the pool as stopped so that nobody waits for a Run that never happens.
+	if atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+		close(p.stop)
+
+		timer := time.NewTimer(p.entryCloseWait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+
+		p.scheduler.close()
+		p.discard()
+		p.cancel()
+		close(p.done)
+		return nil
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+// discard drop the tasks left in the closed queues when the pool is stopped before Run,
+// the journal entries of the tasks are kept so that they are replayed after restart.
+func (p *Pool) discard() {
+	for _, q := range p.scheduler.queues {
+		for t := range q.ch {
+			atomic.AddInt64(&p.stats.queued, -1)
+			if t.future != nil {
+				t.future.complete(ErrPoolClosed)
+			}
+		}
+	}
 }
 
 // Shutdown If all task are sent to the task entry chan, you can call this method to exit smoothly.
+// It does not wait for Run to return.
+//
+// Deprecated: use Stop instead.
 func (p *Pool) Shutdown() {
 	// Create a deadline to manual exit entryCloseWait time.
 	ctx, cancel := context.WithTimeout(context.Background(), p.entryCloseWait)
@@ -301,7 +730,10 @@ func (p *Pool) Shutdown() {
 	// until the timeout deadline.
 	<-ctx.Done()
 
-	p.interrupt <- syscall.SIGTERM
+	p.stopOnce.Do(func() {
+		close(p.stopReq)
+	})
+
 	p.logEntry.Println("work pool will shutdown...")
 }
 
@@ -1,10 +1,20 @@
 package workpool
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestPool(t *testing.T) {
@@ -17,6 +27,7 @@ func TestPool(t *testing.T) {
 		WithExecInterval(100*time.Millisecond),
 		WithEntryCap(10), WithJobCap(10), WithWorkerCap(10),
 		WithLogger(log.New(os.Stderr, "", log.LstdFlags)),
+		WithSignals(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP),
 	)
 
 	// p := NewPool(WithEntryCap(3), WithWorkerCap(10))
@@ -34,7 +45,7 @@ func TestPool(t *testing.T) {
 		}
 	}()
 
-	p.Run()
+	p.Run(context.Background())
 }
 
 func TestShutdown(t *testing.T) {
@@ -65,7 +76,782 @@ func TestShutdown(t *testing.T) {
 		}
 	}()
 
-	p.Run()
+	p.Run(context.Background())
+}
+
+// runPool run the work pool in a goroutine,the returned chan is closed when Run returns.
+func runPool(ctx context.Context, p *Pool) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	return done
+}
+
+// startPool run the work pool in a goroutine,the returned func stops it and waits for Run to return.
+func startPool(t *testing.T, p *Pool) func() {
+	done := runPool(context.Background(), p)
+	return func() {
+		if err := p.Stop(context.Background()); err != nil {
+			t.Fatalf("stop work pool error: %v", err)
+		}
+
+		<-done
+	}
+}
+
+func TestTaskWithContext(t *testing.T) {
+	p := NewPool(
+		WithWorkerCap(2),
+		WithLogger(log.New(os.Stderr, "", log.LstdFlags)),
+		WithEntryCloseWait(100*time.Millisecond),
+		WithShutdownWait(200*time.Millisecond),
+	)
+
+	timeoutErr := make(chan error, 1)
+	shutdownErr := make(chan error, 1)
+	go func() {
+		p.AddTask(NewTaskWithContext(context.Background(), func(ctx context.Context) error {
+			<-ctx.Done()
+			timeoutErr <- ctx.Err()
+			return ctx.Err()
+		}, WithTaskTimeout(50*time.Millisecond)))
+
+		p.AddTask(NewTaskWithContext(context.Background(), func(ctx context.Context) error {
+			<-ctx.Done()
+			shutdownErr <- ctx.Err()
+			return ctx.Err()
+		}))
+
+		p.Stop(context.Background())
+	}()
+
+	p.Run(context.Background())
+
+	if err := <-timeoutErr; err != context.DeadlineExceeded {
+		t.Fatalf("task timeout error: %v", err)
+	}
+
+	if err := <-shutdownErr; err != context.Canceled {
+		t.Fatalf("task shutdown error: %v", err)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	p := NewPool(
+		WithWorkerCap(3),
+		WithEntryCap(10),
+		WithLogger(log.New(os.Stderr, "", log.LstdFlags)),
+		WithEntryCloseWait(100*time.Millisecond),
+	)
+
+	stop := startPool(t, p)
+
+	f := p.Submit(NewTask(func() error {
+		return nil
+	}))
+	if err := f.Wait(); err != nil {
+		t.Fatalf("submit task error: %v", err)
+	}
+
+	taskErr := errors.New("task error")
+	b := p.BatchSubmit([]*Task{
+		NewTask(func() error {
+			return nil
+		}),
+		NewTask(func() error {
+			return taskErr
+		}),
+		NewTask(func() error {
+			panic("task panic")
+		}),
+	})
+
+	err := b.Wait()
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("batch submit error: %v", err)
+	}
+
+	log.Println("batch error: ", batchErr)
+	if batchErr.Total != 3 || len(batchErr.Errors) != 2 || batchErr.Errors[1] != taskErr {
+		t.Fatalf("batch error report: %v", batchErr)
+	}
+
+	stop()
+
+	if err := p.Submit(NewTask(func() error {
+		return nil
+	})).Wait(); err != ErrPoolClosed {
+		t.Fatalf("submit task after shutdown: %v", err)
+	}
+}
+
+func TestWorkerScaling(t *testing.T) {
+	p := NewPool(
+		WithMinWorkers(1),
+		WithMaxWorkers(5),
+		WithWorkerIdleTimeout(100*time.Millisecond),
+		WithExecInterval(0),
+		WithEntryCloseWait(100*time.Millisecond),
+	)
+
+	stop := startPool(t, p)
+
+	release := make(chan struct{})
+	tasks := make([]*Task, 0, 5)
+	for i := 0; i < 5; i++ {
+		tasks = append(tasks, NewTask(func() error {
+			<-release
+			return nil
+		}))
+	}
+
+	b := p.BatchSubmit(tasks)
+	time.Sleep(50 * time.Millisecond)
+	if n := p.WorkerCount(); n != 5 {
+		t.Fatalf("worker count after burst: %d", n)
+	}
+
+	close(release)
+	if err := b.Wait(); err != nil {
+		t.Fatalf("batch error: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if n := p.WorkerCount(); n != 1 {
+		t.Fatalf("worker count after idle: %d", n)
+	}
+
+	stop()
+
+	if n := p.WorkerCount(); n != 0 {
+		t.Fatalf("worker count after shutdown: %d", n)
+	}
+}
+
+func TestQueueWeight(t *testing.T) {
+	p := NewPool(
+		WithWorkerCap(1),
+		WithEntryCap(10),
+		WithExecInterval(0),
+		WithQueue("high", 3),
+		WithQueue("low", 1),
+		WithEntryCloseWait(100*time.Millisecond),
+	)
+
+	stop := startPool(t, p)
+
+	// block the only worker until all tasks are queued.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	gate := p.Submit(NewTask(func() error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+
+	var mu sync.Mutex
+	order := make([]string, 0, 16)
+	newTask := func(name string) *Task {
+		return NewTask(func() error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		}, WithTaskQueue(name))
+	}
+
+	tasks := make([]*Task, 0, 16)
+	for i := 0; i < 8; i++ {
+		tasks = append(tasks, newTask("low"))
+	}
+
+	for i := 0; i < 8; i++ {
+		tasks = append(tasks, newTask("high"))
+	}
+
+	b := p.BatchSubmit(tasks)
+	close(release)
+	if err := gate.Wait(); err != nil {
+		t.Fatalf("gate task error: %v", err)
+	}
+
+	if err := b.Wait(); err != nil {
+		t.Fatalf("batch error: %v", err)
+	}
+
+	log.Println("exec order: ", order)
+
+	// the dispatcher takes the first low task before the high tasks are queued.
+	high := 0
+	for _, name := range order[1:9] {
+		if name == "high" {
+			high++
+		}
+	}
+
+	if high < 5 {
+		t.Fatalf("high queue should be preferred,exec order: %v", order)
+	}
+
+	if err := p.Submit(NewTask(func() error {
+		return nil
+	}, WithTaskQueue("unknown"))).Wait(); err != ErrQueueNotFound {
+		t.Fatalf("submit task to unknown queue: %v", err)
+	}
+
+	stop()
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	newPool := func(opts ...Option) (*Pool, chan struct{}, func()) {
+		opts = append(opts, WithWorkerCap(1), WithEntryCap(1), WithExecInterval(0),
+			WithEntryCloseWait(100*time.Millisecond))
+		p := NewPool(opts...)
+
+		stop := startPool(t, p)
+
+		// block the worker and the dispatcher,then fill the entry chan.
+		release := make(chan struct{})
+		started := make(chan struct{})
+		p.AddTask(NewTask(func() error {
+			close(started)
+			<-release
+			return nil
+		}))
+		<-started
+
+		p.AddTask(NewTask(func() error {
+			return nil
+		}))
+		time.Sleep(20 * time.Millisecond)
+		p.AddTask(NewTask(func() error {
+			return nil
+		}))
+
+		return p, release, stop
+	}
+
+	task := NewTask(func() error {
+		return nil
+	})
+
+	p, release, stop := newPool(WithOverflowPolicy(PolicyReject))
+	if err := p.AddTask(task); err != ErrPoolFull {
+		t.Fatalf("reject policy error: %v", err)
+	}
+
+	close(release)
+	stop()
+
+	if err := p.AddTask(task); err != ErrPoolClosed {
+		t.Fatalf("add task after shutdown: %v", err)
+	}
+
+	p, release, stop = newPool(WithBlockTimeout(50 * time.Millisecond))
+	if err := p.TryAddTask(task); err != ErrPoolFull {
+		t.Fatalf("try add task error: %v", err)
+	}
+
+	if err := p.AddTask(task); err != ErrPoolFull {
+		t.Fatalf("block timeout error: %v", err)
+	}
+
+	close(release)
+	stop()
+
+	p, release, stop = newPool(WithOverflowPolicy(PolicyCallerRuns))
+	ran := false
+	if err := p.AddTask(NewTask(func() error {
+		ran = true
+		return nil
+	})); err != nil || !ran {
+		t.Fatalf("caller runs policy error: %v", err)
+	}
+
+	close(release)
+	stop()
+
+	p, release, stop = newPool(WithOverflowPolicy(PolicyDropOldest))
+	f := p.Submit(task)
+	if err := p.AddTask(task); err != nil {
+		t.Fatalf("drop oldest policy error: %v", err)
+	}
+
+	if err := f.Wait(); err != ErrTaskDropped {
+		t.Fatalf("dropped task error: %v", err)
+	}
+
+	close(release)
+	stop()
+}
+
+func TestRetry(t *testing.T) {
+	errTemporary := errors.New("temporary error")
+	errFatal := errors.New("fatal error")
+
+	deadLetter := make(chan *Task, 2)
+	p := NewPool(
+		WithWorkerCap(2),
+		WithExecInterval(0),
+		WithEntryCloseWait(100*time.Millisecond),
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     10 * time.Millisecond,
+			Jitter:      0.2,
+			Retryable: func(err error) bool {
+				return err != errFatal
+			},
+		}),
+		WithDeadLetter(func(t *Task, err error) {
+			log.Println("dead letter task: ", t.Name(), "attempts: ", t.Attempts(), "error: ", err)
+			deadLetter <- t
+		}),
+	)
+
+	// the exec duration does not include the backoff waits.
+	costs := make(chan time.Duration, 3)
+	p.addObserver(func(d time.Duration, err error) {
+		costs <- d
+	})
+
+	stop := startPool(t, p)
+
+	var attempts int32
+	if err := p.Submit(NewTask(func() error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return errTemporary
+		}
+
+		return nil
+	})).Wait(); err != nil || attempts != 3 {
+		t.Fatalf("retry task error: %v attempts: %d", err, attempts)
+	}
+
+	if d := <-costs; d >= 8*time.Millisecond {
+		t.Fatalf("retry task exec duration: %v", d)
+	}
+
+	if err := p.Submit(NewTask(func() error {
+		return errTemporary
+	}, WithTaskName("temporary"))).Wait(); err != errTemporary {
+		t.Fatalf("exhausted retries error: %v", err)
+	}
+
+	if task := <-deadLetter; task.Name() != "temporary" || task.Attempts() != 3 {
+		t.Fatalf("dead letter task: %s attempts: %d", task.Name(), task.Attempts())
+	}
+
+	if err := p.Submit(NewTask(func() error {
+		return errFatal
+	}, WithTaskName("fatal"))).Wait(); err != errFatal {
+		t.Fatalf("non-retryable error: %v", err)
+	}
+
+	if task := <-deadLetter; task.Name() != "fatal" || task.Attempts() != 1 {
+		t.Fatalf("dead letter task: %s attempts: %d", task.Name(), task.Attempts())
+	}
+
+	stop()
+}
+
+func TestCollector(t *testing.T) {
+	p := NewPool(
+		WithName("test_pool"),
+		WithWorkerCap(2),
+		WithExecInterval(0),
+		WithEntryCloseWait(100*time.Millisecond),
+	)
+
+	stop := startPool(t, p)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewCollector(p))
+
+	err := p.BatchSubmit([]*Task{
+		NewTask(func() error {
+			return nil
+		}),
+		NewTask(func() error {
+			return errors.New("task error")
+		}),
+		NewTask(func() error {
+			panic("task panic")
+		}),
+	}).Wait()
+	if err == nil {
+		t.Fatal("batch submit should return error")
+	}
+
+	s := p.Stats()
+	log.Printf("work pool stats: %+v", s)
+	if s.Completed != 1 || s.Failed != 2 || s.Panicked != 1 || s.Queued != 0 || s.Running != 0 {
+		t.Fatalf("work pool stats: %+v", s)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics error: %v", err)
+	}
+
+	metrics := make(map[string]*dto.Metric, len(mfs))
+	for _, mf := range mfs {
+		metrics[mf.GetName()] = mf.GetMetric()[0]
+	}
+
+	if v := metrics["workpool_tasks_failed_total"].GetCounter().GetValue(); v != 2 {
+		t.Fatalf("failed total: %v", v)
+	}
+
+	if v := metrics["workpool_task_duration_seconds"].GetHistogram().GetSampleCount(); v != 3 {
+		t.Fatalf("duration sample count: %v", v)
+	}
+
+	if v := metrics["workpool_workers"].GetLabel()[0].GetValue(); v != "test_pool" {
+		t.Fatalf("pool label: %v", v)
+	}
+
+	stop()
+}
+
+func TestRunContext(t *testing.T) {
+	// multiple pools in one process,each one is driven by its own context.
+	ctx, cancel := context.WithCancel(context.Background())
+	p1 := NewPool(WithName("p1"), WithEntryCloseWait(50*time.Millisecond))
+	p2 := NewPool(WithName("p2"), WithEntryCloseWait(50*time.Millisecond),
+		WithShutdownWait(time.Minute))
+
+	done1 := runPool(ctx, p1)
+	done2 := runPool(context.Background(), p2)
+
+	if err := p1.Submit(NewTask(func() error {
+		return nil
+	})).Wait(); err != nil {
+		t.Fatalf("p1 task error: %v", err)
+	}
+
+	cancel()
+	<-done1
+
+	if err := p1.AddTask(NewTask(func() error {
+		return nil
+	})); err != ErrPoolClosed {
+		t.Fatalf("add task after run context done: %v", err)
+	}
+
+	// p2 is still running,the hung task is cancelled when the stop context is done.
+	started := make(chan struct{})
+	f := p2.Submit(NewTaskWithContext(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	<-started
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer stopCancel()
+
+	if err := p2.Stop(stopCtx); err != context.DeadlineExceeded {
+		t.Fatalf("stop p2 error: %v", err)
+	}
+
+	if err := f.Wait(); err != context.Canceled {
+		t.Fatalf("hung task error: %v", err)
+	}
+
+	<-done2
+}
+
+func TestStopBeforeRun(t *testing.T) {
+	p := NewPool(WithEntryCap(4), WithEntryCloseWait(50*time.Millisecond))
+
+	// the task queued before Run is discarded by Stop.
+	f := p.Submit(NewTask(func() error {
+		return nil
+	}))
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- p.Stop(context.Background())
+	}()
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("stop before run error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stop before run blocks")
+	}
+
+	select {
+	case <-f.Done():
+		if err := f.Err(); err != ErrPoolClosed {
+			t.Fatalf("queued task error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued task is stranded")
+	}
+
+	if n := p.Stats().Queued; n != 0 {
+		t.Fatalf("queued tasks after stop: %d", n)
+	}
+
+	// the stopped pool neither runs nor accepts tasks.
+	select {
+	case <-runPool(context.Background(), p):
+	case <-time.After(time.Second):
+		t.Fatal("run after stop blocks")
+	}
+
+	if err := p.AddTask(NewTask(func() error {
+		return nil
+	})); err != ErrPoolClosed {
+		t.Fatalf("add task after stop error: %v", err)
+	}
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("stop twice error: %v", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workpool")
+	if err != nil {
+		t.Fatalf("create temp dir error: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tasks.journal")
+	j, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatalf("open journal error: %v", err)
+	}
+
+	// the first process accepts 3 tasks,but only the first one is completed.
+	p := NewPool(
+		WithWorkerCap(1),
+		WithEntryCap(10),
+		WithExecInterval(0),
+		WithJournal(j),
+		WithEntryCloseWait(50*time.Millisecond),
+		WithShutdownWait(50*time.Millisecond),
+	)
+
+	started := make(chan struct{}, 3)
+	p.Register("echo", func(ctx context.Context, payload []byte) error {
+		started <- struct{}{}
+		if string(payload) == "1" {
+			return nil
+		}
+
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	stop := startPool(t, p)
+
+	for _, payload := range []string{"1", "2", "3"} {
+		task, err := p.NewNamedTask("echo", []byte(payload))
+		if err != nil {
+			t.Fatalf("new named task error: %v", err)
+		}
+
+		p.AddTask(task)
+	}
+
+	<-started
+	<-started
+	stop()
+	j.Close()
+
+	// restart and replay the pending tasks.
+	j, err = NewFileJournal(path)
+	if err != nil {
+		t.Fatalf("reopen journal error: %v", err)
+	}
+
+	defer j.Close()
+
+	recs, err := j.Pending()
+	if err != nil || len(recs) != 2 || string(recs[0].Payload) != "2" || string(recs[1].Payload) != "3" {
+		t.Fatalf("pending tasks: %v error: %v", recs, err)
+	}
+
+	p = NewPool(WithJournal(j), WithExecInterval(0), WithEntryCloseWait(50*time.Millisecond))
+	replayed := make(chan string, 2)
+	p.Register("echo", func(ctx context.Context, payload []byte) error {
+		replayed <- string(payload)
+		return nil
+	})
+
+	stop = startPool(t, p)
+
+	if a, b := <-replayed, <-replayed; a+b != "23" && a+b != "32" {
+		t.Fatalf("replayed tasks: %s %s", a, b)
+	}
+
+	stop()
+
+	if recs, err = j.Pending(); err != nil || len(recs) != 0 {
+		t.Fatalf("pending tasks after replay: %v error: %v", recs, err)
+	}
+
+	if _, err := p.NewNamedTask("unknown", nil); err != ErrHandlerNotFound {
+		t.Fatalf("new unknown named task error: %v", err)
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workpool")
+	if err != nil {
+		t.Fatalf("create temp dir error: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tasks.journal")
+	j, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatalf("open journal error: %v", err)
+	}
+
+	defer j.Close()
+
+	j.SetCompactThreshold(10)
+
+	lines := func() int {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read journal error: %v", err)
+		}
+
+		n := 0
+		for _, c := range b {
+			if c == '\n' {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	if err := j.Append(&Record{ID: "keep", Name: "echo"}); err != nil {
+		t.Fatalf("append error: %v", err)
+	}
+
+	// the acked entries are removed once the threshold is reached.
+	for i := 0; i < 25; i++ {
+		id := "task-" + string(rune('a'+i))
+		if err := j.Append(&Record{ID: id, Name: "echo"}); err != nil {
+			t.Fatalf("append error: %v", err)
+		}
+
+		if err := j.Ack(id); err != nil {
+			t.Fatalf("ack error: %v", err)
+		}
+	}
+
+	if n := lines(); n >= 20 {
+		t.Fatalf("journal lines after auto compaction: %d", n)
+	}
+
+	if err := j.Compact(); err != nil {
+		t.Fatalf("compact error: %v", err)
+	}
+
+	if n := lines(); n != 1 {
+		t.Fatalf("journal lines after compaction: %d", n)
+	}
+
+	// the journal is still writable after compaction.
+	if err := j.Append(&Record{ID: "next", Name: "echo"}); err != nil {
+		t.Fatalf("append after compaction error: %v", err)
+	}
+
+	recs, err := j.Pending()
+	if err != nil || len(recs) != 2 || recs[0].ID != "keep" || recs[1].ID != "next" {
+		t.Fatalf("pending tasks: %v error: %v", recs, err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	p := NewPool(
+		WithWorkerCap(3),
+		WithRateLimit(20, 1),
+		WithQueue("slow", 1),
+		WithQueueRateLimit("slow", 5, 1),
+		WithEntryCloseWait(50*time.Millisecond),
+	)
+
+	stop := startPool(t, p)
+
+	newTasks := func(n int, opts ...TaskOption) []*Task {
+		tasks := make([]*Task, 0, n)
+		for i := 0; i < n; i++ {
+			tasks = append(tasks, NewTask(func() error {
+				return nil
+			}, opts...))
+		}
+
+		return tasks
+	}
+
+	// 6 tasks take 5 tokens at 20 tasks per second.
+	start := time.Now()
+	if err := p.BatchSubmit(newTasks(6)).Wait(); err != nil {
+		t.Fatalf("batch error: %v", err)
+	}
+
+	if cost := time.Since(start); cost < 200*time.Millisecond {
+		t.Fatalf("rate limit does not work,cost: %v", cost)
+	}
+
+	// 3 tasks take 2 tokens at 5 tasks per second in the slow queue.
+	start = time.Now()
+	if err := p.BatchSubmit(newTasks(3, WithTaskQueue("slow"))).Wait(); err != nil {
+		t.Fatalf("batch error: %v", err)
+	}
+
+	if cost := time.Since(start); cost < 350*time.Millisecond {
+		t.Fatalf("queue rate limit does not work,cost: %v", cost)
+	}
+
+	stop()
+
+	// the task waiting on the slow queue does not take the global tokens.
+	p = NewPool(
+		WithWorkerCap(3),
+		WithExecInterval(0),
+		WithRateLimit(2, 2),
+		WithQueue("slow", 1),
+		WithQueueRateLimit("slow", 1, 1),
+		WithEntryCloseWait(50*time.Millisecond),
+	)
+
+	stop = startPool(t, p)
+	slow := p.BatchSubmit(newTasks(2, WithTaskQueue("slow")))
+	time.Sleep(50 * time.Millisecond)
+
+	start = time.Now()
+	if err := p.BatchSubmit(newTasks(2)).Wait(); err != nil {
+		t.Fatalf("batch error: %v", err)
+	}
+
+	if cost := time.Since(start); cost > 800*time.Millisecond {
+		t.Fatalf("slow queue holds the global tokens,cost: %v", cost)
+	}
+
+	if err := slow.Wait(); err != nil {
+		t.Fatalf("slow batch error: %v", err)
+	}
+
+	stop()
 }
 
 /**
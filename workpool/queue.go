@@ -0,0 +1,170 @@
+package workpool
+
+import (
+	"errors"
+	"reflect"
+)
+
+// DefaultQueue the name of the default task queue.
+const DefaultQueue = "default"
+
+// ErrQueueNotFound the task queue is not registered by WithQueue.
+var ErrQueueNotFound = errors.New("task queue not found")
+
+// queue a named task queue with weight.
+type queue struct {
+	name    string
+	weight  int
+	current int // current weight of smooth weighted round-robin
+	closed  bool
+	ch      chan *Task
+}
+
+// scheduler pick task from queues by smooth weighted round-robin,
+// so that the higher weight queue gets more chances to be executed,
+// and the lower weight queue still makes progress.
+// It is only used by the dispatch goroutine of the work pool.
+type scheduler struct {
+	queues []*queue
+	index  map[string]*queue
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		index: make(map[string]*queue),
+	}
+}
+
+// add register a queue,the weight of an existing queue will be updated.
+func (s *scheduler) add(name string, weight int, ch chan *Task) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	if q, ok := s.index[name]; ok {
+		q.weight = weight
+		return
+	}
+
+	q := &queue{
+		name:   name,
+		weight: weight,
+		ch:     ch,
+	}
+
+	s.queues = append(s.queues, q)
+	s.index[name] = q
+}
+
+// get returns the queue by name,empty name means the default queue.
+func (s *scheduler) get(name string) (*queue, error) {
+	if name == "" {
+		name = DefaultQueue
+	}
+
+	q, ok := s.index[name]
+	if !ok {
+		return nil, ErrQueueNotFound
+	}
+
+	return q, nil
+}
+
+// close close all queue chan.
+func (s *scheduler) close() {
+	for _, q := range s.queues {
+		close(q.ch)
+	}
+}
+
+// next returns the next task,
+// it blocks until a task is available or all queues are closed.
+func (s *scheduler) next() (*Task, bool) {
+	for {
+		if t, ok := s.pick(); ok {
+			return t, true
+		}
+
+		// all queues are empty,block until any queue receives a task.
+		open := make([]*queue, 0, len(s.queues))
+		for _, q := range s.queues {
+			if !q.closed {
+				open = append(open, q)
+			}
+		}
+
+		if len(open) == 0 {
+			return nil, false
+		}
+
+		if len(open) == 1 {
+			t, ok := <-open[0].ch
+			if !ok {
+				open[0].closed = true
+				continue
+			}
+
+			return t, true
+		}
+
+		cases := make([]reflect.SelectCase, 0, len(open))
+		for _, q := range open {
+			cases = append(cases, reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(q.ch),
+			})
+		}
+
+		i, v, ok := reflect.Select(cases)
+		if !ok {
+			open[i].closed = true
+			continue
+		}
+
+		return v.Interface().(*Task), true
+	}
+}
+
+// pick returns a ready task by smooth weighted round-robin without blocking.
+func (s *scheduler) pick() (*Task, bool) {
+	total := 0
+	for _, q := range s.queues {
+		if !q.closed {
+			q.current += q.weight
+			total += q.weight
+		}
+	}
+
+	tried := make(map[*queue]bool, len(s.queues))
+	for {
+		var best *queue
+		for _, q := range s.queues {
+			if q.closed || tried[q] {
+				continue
+			}
+
+			if best == nil || q.current > best.current {
+				best = q
+			}
+		}
+
+		if best == nil {
+			return nil, false
+		}
+
+		select {
+		case t, ok := <-best.ch:
+			if !ok {
+				best.closed = true
+				continue
+			}
+
+			best.current -= total
+			return t, true
+		default:
+			// the empty queue does not accumulate weight.
+			best.current = 0
+			tried[best] = true
+		}
+	}
+}
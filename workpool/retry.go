@@ -0,0 +1,106 @@
+package workpool
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy the retry policy of the failed task.
+type RetryPolicy struct {
+	// MaxAttempts max exec attempts of the task,including the first exec.
+	MaxAttempts int
+
+	// Backoff the wait time before the first retry,default 100ms.
+	Backoff time.Duration
+
+	// MaxBackoff the max wait time before each retry,default 10s.
+	MaxBackoff time.Duration
+
+	// Multiplier the backoff multiplier after each retry,default 2.
+	Multiplier float64
+
+	// Jitter random jitter factor of the backoff,in range [0,1].
+	// eg: 0.2 means the backoff is randomized in range [0.8*backoff,1.2*backoff].
+	Jitter float64
+
+	// Retryable reports whether the error is retryable,
+	// nil means all errors are retryable.
+	Retryable func(err error) bool
+}
+
+// DeadLetterFunc handle the task which fails finally,
+// eg: exhausted retries or returns a non-retryable error.
+type DeadLetterFunc func(t *Task, err error)
+
+// WithRetryPolicy change the default retry policy of each task.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *Pool) {
+		p.retryPolicy = &policy
+	}
+}
+
+// WithDeadLetter change the dead letter handler.
+func WithDeadLetter(fn DeadLetterFunc) Option {
+	return func(p *Pool) {
+		p.deadLetter = fn
+	}
+}
+
+// retryable reports whether the task should be retried after the attempts.
+func (r *RetryPolicy) retryable(err error, attempts int) bool {
+	if r == nil || attempts >= r.MaxAttempts {
+		return false
+	}
+
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+
+	return true
+}
+
+// backoff returns the wait time before the next retry,
+// it grows exponentially with the attempts.
+func (r *RetryPolicy) backoff(attempts int) time.Duration {
+	backoff := r.Backoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	maxBackoff := r.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(backoff) * math.Pow(multiplier, float64(attempts-1))
+	if d > float64(maxBackoff) {
+		d = float64(maxBackoff)
+	}
+
+	if r.Jitter > 0 {
+		jitter := math.Min(r.Jitter, 1)
+		d += d * jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// sleepContext sleep d and returns false when the ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
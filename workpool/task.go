@@ -0,0 +1,136 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTaskPanic the task panics when exec,
+// the error returned by the task wraps it.
+var ErrTaskPanic = errors.New("task panic")
+
+// Task task struct.
+type Task struct {
+	fn       func(ctx context.Context) error
+	ctx      context.Context // task parent context
+	name     string          // task name
+	timeout  time.Duration   // task exec timeout,zero means no timeout
+	future   *Future         // the future of the submitted task
+	queue    string          // the queue name of the task,empty means the default queue
+	retry    *RetryPolicy    // task retry policy
+	attempts int             // exec attempts of the task
+
+	// the named task created by Pool.NewNamedTask can be persisted in the journal.
+	payload   []byte
+	durable   bool
+	journalID string
+}
+
+// TaskOption func TaskOption to change task.
+type TaskOption func(t *Task)
+
+// WithTaskName set the name of the task.
+func WithTaskName(name string) TaskOption {
+	return func(t *Task) {
+		t.name = name
+	}
+}
+
+// WithTaskTimeout set the exec timeout of each attempt of the task.
+func WithTaskTimeout(d time.Duration) TaskOption {
+	return func(t *Task) {
+		t.timeout = d
+	}
+}
+
+// WithTaskQueue set the queue of the task,the queue must be registered by WithQueue.
+func WithTaskQueue(name string) TaskOption {
+	return func(t *Task) {
+		t.queue = name
+	}
+}
+
+// WithTaskRetry set the retry policy of the task,
+// it overrides the default retry policy of the work pool.
+func WithTaskRetry(policy RetryPolicy) TaskOption {
+	return func(t *Task) {
+		t.retry = &policy
+	}
+}
+
+// NewTask returns task,create a task entry.
+func NewTask(fn func() error, opts ...TaskOption) *Task {
+	return NewTaskWithContext(context.Background(), func(ctx context.Context) error {
+		return fn()
+	}, opts...)
+}
+
+// NewTaskWithContext returns a context-aware task.
+// The ctx passed to fn is cancelled when the parent ctx is done,
+// the task timeout expires or the work pool is shutdown.
+func NewTaskWithContext(ctx context.Context, fn func(ctx context.Context) error, opts ...TaskOption) *Task {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	t := &Task{
+		fn:  fn,
+		ctx: ctx,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// Name returns the name of the task.
+func (t *Task) Name() string {
+	return t.name
+}
+
+// Attempts returns the exec attempts of the task.
+func (t *Task) Attempts() int {
+	return t.attempts
+}
+
+// context returns the exec context of the task,
+// it will be cancelled when the root context of work pool is done.
+func (t *Task) context(root context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	go func() {
+		select {
+		case <-root.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// run exec the task once and returns the error of the task.
+func (t *Task) run(ctx context.Context, timeout time.Duration, logEntry Logger) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			logEntry.Println("exec current task panic: ", e)
+			err = fmt.Errorf("%w: %v", ErrTaskPanic, e)
+		}
+	}()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err = t.fn(ctx)
+	if err != nil {
+		logEntry.Println("exec task error: ", err)
+	}
+
+	return err
+}